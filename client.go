@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/delicb/kioto/cliware"
+	"github.com/delicb/kioto/codec"
 	"github.com/delicb/kioto/middlewares/headers"
 	"github.com/delicb/kioto/middlewares/retry"
 )
@@ -30,6 +31,7 @@ type Client struct {
 	preMiddlewares  *cliware.Chain
 	postMiddlewares *cliware.Chain
 	doer            HTTPDoer
+	codecs          *codec.Registry
 }
 
 // New returns fresh instance of Client configured with provided options.
@@ -59,10 +61,35 @@ func New(options ...ClientOption) *Client {
 		preMiddlewares.Use(headers.Set("User-Agent", opts.userAgent.String()))
 	}
 
+	if opts.retryBudget != nil && !opts.disableRetry {
+		preMiddlewares.Use(retry.UseBudget(opts.retryBudget))
+	}
+
+	codecs := codec.Default.Clone()
+	for mediaType, c := range opts.codecs {
+		codecs.Register(mediaType, c)
+	}
+
+	postMiddlewares := cliware.NewChain(opts.potsMiddlewares...)
+	if opts.cookieJar != nil {
+		if client, ok := sender.(*http.Client); ok {
+			// http.Client follows redirects internally, only its jar sees
+			// cookies set by redirect responses. Copy is used, so that client
+			// provided by caller (e.g. http.DefaultClient) is not changed.
+			withJar := *client
+			withJar.Jar = opts.cookieJar
+			sender = &withJar
+		} else {
+			// URL is known only after request specific middlewares are applied
+			postMiddlewares.Use(opts.cookieJar)
+		}
+	}
+
 	return &Client{
 		doer:            sender,
 		preMiddlewares:  preMiddlewares,
-		postMiddlewares: cliware.NewChain(opts.potsMiddlewares...),
+		postMiddlewares: postMiddlewares,
+		codecs:          codecs,
 	}
 }
 
@@ -94,6 +121,13 @@ func (c *Client) UsePostFunc(m func(cliware.Handler) cliware.Handler) *Client {
 	return c
 }
 
+// Codecs returns codec registry used by this client for encoding request
+// bodies and decoding responses. Codecs registered to it are used by all
+// subsequent requests.
+func (c *Client) Codecs() *codec.Registry {
+	return c.codecs
+}
+
 // Request creates and returns new instance of *Request.
 func (c *Client) Request() *Request {
 	return NewRequest(c)
@@ -1,10 +1,18 @@
 package kioto
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/delicb/kioto/middlewares/cookies"
+	"github.com/delicb/kioto/middlewares/retry"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -28,3 +36,161 @@ func TestDefaultClientUserAgent(t *testing.T) {
 	_, _ = client.Request().Get().Send()
 	assert.Regexp(t, "foobar/0.1 .*", baseClient.lastRequest.Header.Get("User-Agent"))
 }
+
+type failingRoundTripper struct {
+	noCalls int
+}
+
+func (rt *failingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt.noCalls++
+	return nil, errors.New("round trip error")
+}
+
+func TestClientRetryBudget(t *testing.T) {
+	transport := &failingRoundTripper{}
+	budget := retry.NewBudget(0.1, 2)
+	client := New(HTTPClient(&http.Client{Transport: transport}), RetryBudget(budget))
+
+	_, err := client.Request().Get().URL("http://example.com").Use(
+		retry.Times(5),
+		retry.SetBackoffStrategy(retry.ConstantBackoff(time.Millisecond)),
+	).Send()
+
+	assert.True(t, errors.Is(err, retry.ErrBudgetExhausted), "expected budget exhausted error, got: %v", err)
+	assert.Equal(t, 3, transport.noCalls, "wrong number of attempts")
+	assert.Equal(t, 0, budget.Available(), "budget not used")
+}
+
+type csvCodec struct{}
+
+func (csvCodec) ContentType() string { return "application/csv" }
+
+func (csvCodec) Encode(w io.Writer, v interface{}) error {
+	_, err := io.WriteString(w, strings.Join(v.([]string), ","))
+	return err
+}
+
+func (csvCodec) Decode(r io.Reader, v interface{}) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	target, ok := v.(*[]string)
+	if !ok {
+		return fmt.Errorf("can not decode into %T", v)
+	}
+	*target = strings.Split(string(data), ",")
+	return nil
+}
+
+type echoClient struct {
+	lastRequest *http.Request
+}
+
+func (d *echoClient) Do(req *http.Request) (*http.Response, error) {
+	d.lastRequest = req
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {req.Header.Get("Content-Type")}},
+		Body:       req.Body,
+	}, nil
+}
+
+func TestClientCodec(t *testing.T) {
+	doer := &echoClient{}
+	client := New(HTTPClient(doer), Codec("application/csv", csvCodec{}))
+
+	resp, err := client.Request().Encode("application/csv", []string{"a", "b"}).Send()
+	assert.NoError(t, err)
+	assert.Equal(t, "POST", doer.lastRequest.Method)
+
+	var result []string
+	assert.NoError(t, resp.Decode(&result))
+	assert.Equal(t, []string{"a", "b"}, result)
+
+	_, err = New().Codecs().Lookup("application/csv")
+	assert.Error(t, err, "codec registered on other client")
+}
+
+func cookieServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret", Path: "/"})
+			http.Redirect(w, r, "/home", http.StatusFound)
+		case "/set":
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret", Path: "/"})
+		default:
+			for _, cookie := range r.Cookies() {
+				fmt.Fprintf(w, "%s=%s;", cookie.Name, cookie.Value)
+			}
+		}
+	}))
+}
+
+// doerFunc is HTTPDoer that is not *http.Client.
+type doerFunc func(req *http.Request) (*http.Response, error)
+
+func (f doerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestClientCookieJar(t *testing.T) {
+	server := cookieServer()
+	defer server.Close()
+
+	jar, err := cookies.NewJar(cookies.AllowAnyDomain())
+	assert.NoError(t, err)
+	client := New(CookieJar(jar))
+	assert.Equal(t, jar, client.doer.(*http.Client).Jar)
+
+	// cookie is set by redirect response
+	resp, err := client.Request().Get().URL(server.URL + "/login").Send()
+	assert.NoError(t, err)
+	body, err := resp.String()
+	assert.NoError(t, err)
+	assert.Equal(t, "session=secret;", body, "cookie not sent after redirect")
+
+	resp, err = client.Request().Get().URL(server.URL + "/profile").Send()
+	assert.NoError(t, err)
+	body, err = resp.String()
+	assert.NoError(t, err)
+	assert.Equal(t, "session=secret;", body)
+}
+
+func TestClientCookieJarProvidedClient(t *testing.T) {
+	server := cookieServer()
+	defer server.Close()
+
+	jar, err := cookies.NewJar(cookies.AllowAnyDomain())
+	assert.NoError(t, err)
+	provided := &http.Client{}
+	client := New(HTTPClient(provided), CookieJar(jar))
+	assert.Nil(t, provided.Jar, "provided client changed")
+	assert.Equal(t, jar, client.doer.(*http.Client).Jar)
+
+	resp, err := client.Request().Get().URL(server.URL + "/login").Send()
+	assert.NoError(t, err)
+	body, err := resp.String()
+	assert.NoError(t, err)
+	assert.Equal(t, "session=secret;", body)
+}
+
+func TestClientCookieJarCustomDoer(t *testing.T) {
+	server := cookieServer()
+	defer server.Close()
+
+	jar, err := cookies.NewJar(cookies.AllowAnyDomain())
+	assert.NoError(t, err)
+	client := New(HTTPClient(doerFunc(http.DefaultClient.Do)), CookieJar(jar))
+
+	resp, err := client.Request().Get().URL(server.URL + "/set").Send()
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	resp, err = client.Request().Get().URL(server.URL + "/profile").Send()
+	assert.NoError(t, err)
+	body, err := resp.String()
+	assert.NoError(t, err)
+	assert.Equal(t, "session=secret;", body)
+}
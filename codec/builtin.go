@@ -0,0 +1,137 @@
+package codec
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"github.com/delicb/kioto/form"
+)
+
+var (
+	// JSON is codec for application/json media type.
+	JSON Codec = jsonCodec{}
+	// XML is codec for application/xml media type.
+	XML Codec = xmlCodec{}
+	// Form is codec for application/x-www-form-urlencoded media type. Values
+	// are encoded using form package and decoded into *url.Values,
+	// *map[string][]string or *map[string]string.
+	Form Codec = formCodec{}
+	// Text is codec for text/plain media type. Values are decoded into
+	// *string or *[]byte and encoded from string, []byte or fmt.Stringer.
+	Text Codec = textCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string { return "application/json" }
+
+func (jsonCodec) Encode(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func (jsonCodec) Decode(r io.Reader, v interface{}) error {
+	err := json.NewDecoder(r).Decode(v)
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+type xmlCodec struct{}
+
+func (xmlCodec) ContentType() string { return "application/xml" }
+
+func (xmlCodec) Encode(w io.Writer, v interface{}) error {
+	return xml.NewEncoder(w).Encode(v)
+}
+
+func (xmlCodec) Decode(r io.Reader, v interface{}) error {
+	err := xml.NewDecoder(r).Decode(v)
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+type formCodec struct{}
+
+func (formCodec) ContentType() string { return "application/x-www-form-urlencoded" }
+
+func (formCodec) Encode(w io.Writer, v interface{}) error {
+	values, err := form.Encode(v)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, values.Encode())
+	return err
+}
+
+func (formCodec) Decode(r io.Reader, v interface{}) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	values, err := url.ParseQuery(strings.TrimSpace(string(data)))
+	if err != nil {
+		return err
+	}
+	switch target := v.(type) {
+	case *url.Values:
+		*target = values
+	case *map[string][]string:
+		*target = values
+	case *map[string]string:
+		m := make(map[string]string, len(values))
+		for k := range values {
+			m[k] = values.Get(k)
+		}
+		*target = m
+	default:
+		return fmt.Errorf("codec: form can not be decoded into %T", v)
+	}
+	return nil
+}
+
+type textCodec struct{}
+
+func (textCodec) ContentType() string { return "text/plain; charset=utf-8" }
+
+func (textCodec) Encode(w io.Writer, v interface{}) error {
+	var err error
+	switch data := v.(type) {
+	case string:
+		_, err = io.WriteString(w, data)
+	case []byte:
+		_, err = w.Write(data)
+	case fmt.Stringer:
+		_, err = io.WriteString(w, data.String())
+	default:
+		err = fmt.Errorf("codec: %T can not be encoded as text", v)
+	}
+	return err
+}
+
+func (textCodec) Decode(r io.Reader, v interface{}) error {
+	switch target := v.(type) {
+	case *string:
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		*target = string(data)
+	case *[]byte:
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		*target = data
+	default:
+		return fmt.Errorf("codec: text can not be decoded into %T", v)
+	}
+	return nil
+}
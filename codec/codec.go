@@ -0,0 +1,121 @@
+// Package codec provides registry of encoders and decoders for HTTP bodies,
+// selected by media type.
+//
+// Registry is used by kioto.Response to decode response body based on its
+// Content-Type header and by body package to encode request body, so that
+// request encoding and response decoding stay symmetric.
+package codec
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"sync"
+)
+
+// Codec encodes and decodes values to and from HTTP body in one format.
+type Codec interface {
+	// ContentType returns media type of data produced by Encode.
+	ContentType() string
+	// Encode writes encoded value to provided writer.
+	Encode(w io.Writer, v interface{}) error
+	// Decode reads data from provided reader into value, which in general
+	// should be a pointer.
+	Decode(r io.Reader, v interface{}) error
+}
+
+// UnsupportedContentTypeError is returned when there is no codec registered
+// for content type.
+type UnsupportedContentTypeError struct {
+	ContentType string
+}
+
+// Error is implementation of error interface.
+func (e *UnsupportedContentTypeError) Error() string {
+	if e.ContentType == "" {
+		return "codec: missing content type"
+	}
+	return fmt.Sprintf("codec: unsupported content type %q", e.ContentType)
+}
+
+// Registry holds codecs by media type. It is safe for concurrent use.
+type Registry struct {
+	mu     sync.RWMutex
+	codecs map[string]Codec
+}
+
+// NewRegistry creates empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		codecs: make(map[string]Codec),
+	}
+}
+
+// Default is registry with built-in codecs:
+//   - application/json (and any media type with +json suffix)
+//   - application/xml and text/xml (and any media type with +xml suffix)
+//   - application/x-www-form-urlencoded
+//   - text/plain (and any other text media type)
+var Default = newDefault()
+
+func newDefault() *Registry {
+	r := NewRegistry()
+	r.Register("application/json", JSON)
+	r.Register("application/xml", XML)
+	r.Register("text/xml", XML)
+	r.Register("application/x-www-form-urlencoded", Form)
+	r.Register("text/plain", Text)
+	r.Register("text/*", Text)
+	return r
+}
+
+// Register adds codec for provided media type, replacing existing one.
+// Media type can be wildcard for all subtypes (e.g. "text/*"), which is
+// used only if there is no codec for exact media type.
+func (r *Registry) Register(mediaType string, c Codec) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.codecs[strings.ToLower(mediaType)] = c
+}
+
+// Lookup returns codec for provided content type. Parameters (e.g. charset)
+// are ignored. If there is no codec for exact media type, codec registered
+// for structured syntax suffix (e.g. application/json for
+// application/problem+json) or for wildcard subtype is returned. If there
+// is no matching codec, *UnsupportedContentTypeError is returned.
+func (r *Registry) Lookup(contentType string) (Codec, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, &UnsupportedContentTypeError{ContentType: contentType}
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if c, ok := r.codecs[mediaType]; ok {
+		return c, nil
+	}
+	if i := strings.LastIndex(mediaType, "+"); i >= 0 {
+		if c, ok := r.codecs["application/"+mediaType[i+1:]]; ok {
+			return c, nil
+		}
+	}
+	if i := strings.Index(mediaType, "/"); i >= 0 {
+		if c, ok := r.codecs[mediaType[:i]+"/*"]; ok {
+			return c, nil
+		}
+	}
+	return nil, &UnsupportedContentTypeError{ContentType: contentType}
+}
+
+// Clone returns new registry with same codecs. Changes to returned registry
+// do not affect original.
+func (r *Registry) Clone() *Registry {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	clone := NewRegistry()
+	for k, v := range r.codecs {
+		clone.codecs[k] = v
+	}
+	return clone
+}
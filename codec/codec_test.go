@@ -0,0 +1,105 @@
+package codec_test
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/delicb/kioto/codec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookup(t *testing.T) {
+	for _, data := range []struct {
+		contentType string
+		expected    codec.Codec
+	}{
+		{"application/json", codec.JSON},
+		{"Application/JSON; charset=utf-8", codec.JSON},
+		{"application/problem+json", codec.JSON},
+		{"application/xml", codec.XML},
+		{"text/xml", codec.XML},
+		{"application/atom+xml", codec.XML},
+		{"application/x-www-form-urlencoded", codec.Form},
+		{"text/plain", codec.Text},
+		{"text/html; charset=utf-8", codec.Text},
+	} {
+		c, err := codec.Default.Lookup(data.contentType)
+		assert.NoError(t, err, data.contentType)
+		assert.Equal(t, data.expected, c, data.contentType)
+	}
+}
+
+func TestLookupUnsupported(t *testing.T) {
+	for _, contentType := range []string{"", "application/octet-stream", "image/png", ";;"} {
+		_, err := codec.Default.Lookup(contentType)
+		require.Error(t, err, contentType)
+		unsupported, ok := err.(*codec.UnsupportedContentTypeError)
+		require.True(t, ok, "wrong error type: %T", err)
+		assert.Equal(t, contentType, unsupported.ContentType)
+	}
+}
+
+func TestRegisterAndClone(t *testing.T) {
+	registry := codec.NewRegistry()
+	registry.Register("application/json", codec.JSON)
+	clone := registry.Clone()
+	clone.Register("text/plain", codec.Text)
+
+	_, err := registry.Lookup("text/plain")
+	assert.Error(t, err, "clone modified original registry")
+	c, err := clone.Lookup("text/plain")
+	assert.NoError(t, err)
+	assert.Equal(t, codec.Text, c)
+	_, err = clone.Lookup("application/json")
+	assert.NoError(t, err)
+}
+
+func TestRoundTrip(t *testing.T) {
+	type d struct {
+		A string `json:"a" xml:"a"`
+	}
+	for _, c := range []codec.Codec{codec.JSON, codec.XML} {
+		buff := &bytes.Buffer{}
+		require.NoError(t, c.Encode(buff, d{A: "foo"}))
+		result := new(d)
+		require.NoError(t, c.Decode(buff, result))
+		assert.Equal(t, "foo", result.A, c.ContentType())
+	}
+}
+
+func TestForm(t *testing.T) {
+	buff := &bytes.Buffer{}
+	require.NoError(t, codec.Form.Encode(buff, struct {
+		A string   `form:"a"`
+		B []string `form:"b"`
+	}{A: "foo", B: []string{"1", "2"}}))
+	assert.Equal(t, "a=foo&b=1&b=2", buff.String())
+
+	var values url.Values
+	require.NoError(t, codec.Form.Decode(strings.NewReader(buff.String()), &values))
+	assert.Equal(t, url.Values{"a": {"foo"}, "b": {"1", "2"}}, values)
+
+	var m map[string]string
+	require.NoError(t, codec.Form.Decode(strings.NewReader(buff.String()), &m))
+	assert.Equal(t, map[string]string{"a": "foo", "b": "1"}, m)
+
+	assert.Error(t, codec.Form.Decode(strings.NewReader("a=b"), new(string)))
+}
+
+func TestText(t *testing.T) {
+	buff := &bytes.Buffer{}
+	require.NoError(t, codec.Text.Encode(buff, "foo"))
+	require.NoError(t, codec.Text.Encode(buff, []byte("bar")))
+	assert.Error(t, codec.Text.Encode(buff, 42))
+
+	var s string
+	require.NoError(t, codec.Text.Decode(strings.NewReader("foo"), &s))
+	assert.Equal(t, "foo", s)
+	var b []byte
+	require.NoError(t, codec.Text.Decode(strings.NewReader("bar"), &b))
+	assert.Equal(t, []byte("bar"), b)
+	assert.Error(t, codec.Text.Decode(strings.NewReader("foo"), new(int)))
+}
@@ -0,0 +1,264 @@
+// Package form encodes Go values into URL-encoded form values, as used in
+// application/x-www-form-urlencoded request bodies and URL query strings.
+//
+// Structs are encoded field by field. Field name in form can be customized
+// with "form" struct tag, same way as with "json" tag:
+//
+//	type Search struct {
+//		Query   string    `form:"q"`
+//		Tags    []string  `form:"tag,omitempty"`
+//		Since   time.Time `form:"since,omitempty" layout:"2006-01-02"`
+//		Until   time.Time `form:"until,unix"`
+//		Page    *Page     `form:"page"`
+//		Ignored string    `form:"-"`
+//	}
+//
+// Supported tag options are:
+//   - omitempty - field is omitted if it has zero value
+//   - unix - time.Time is encoded as number of seconds since Unix epoch
+//
+// Time values are encoded in RFC 3339 format, unless different layout is
+// provided with "layout" struct tag. Slices and arrays are encoded as
+// repeated keys. Nested structs and maps are encoded with keys in brackets
+// (e.g. "page[size]") and slices of structs with index in brackets (e.g.
+// "items[0][name]"). Embedded structs without name in tag are flattened.
+// Nil pointers and interfaces are omitted. Values implementing
+// encoding.TextMarshaler are encoded using it.
+package form
+
+import (
+	"encoding"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Encode converts provided value to form values. Supported values are
+// url.Values, map[string]string, map[string][]string, maps with string keys
+// and structs (or pointers to them).
+func Encode(v interface{}) (url.Values, error) {
+	switch data := v.(type) {
+	case url.Values:
+		return data, nil
+	case map[string][]string:
+		return url.Values(data), nil
+	case map[string]string:
+		values := make(url.Values, len(data))
+		for k, val := range data {
+			values.Set(k, val)
+		}
+		return values, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return url.Values{}, nil
+		}
+		rv = rv.Elem()
+	}
+
+	values := make(url.Values)
+	switch rv.Kind() {
+	case reflect.Struct:
+		if err := encodeStruct(values, "", rv); err != nil {
+			return nil, err
+		}
+	case reflect.Map:
+		if err := encodeMap(values, "", rv); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("form: unsupported type %s, expected struct or map", rv.Type())
+	}
+	return values, nil
+}
+
+// fieldOptions holds information parsed from struct tags.
+type fieldOptions struct {
+	omitEmpty bool
+	unix      bool
+	layout    string
+}
+
+func encodeStruct(values url.Values, prefix string, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag := field.Tag.Get("form")
+		if tag == "-" {
+			continue
+		}
+		name, opts := parseTag(tag)
+		opts.layout = field.Tag.Get("layout")
+
+		fv := rv.Field(i)
+		if field.Anonymous && name == "" {
+			embedded := fv
+			for embedded.Kind() == reflect.Ptr {
+				if embedded.IsNil() {
+					break
+				}
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct && embedded.Type() != timeType {
+				if err := encodeStruct(values, prefix, embedded); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		// unexported fields are skipped
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if opts.omitEmpty && fv.IsZero() {
+			continue
+		}
+		if err := encodeValue(values, joinKey(prefix, name), fv, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeMap(values url.Values, prefix string, rv reflect.Value) error {
+	if rv.Type().Key().Kind() != reflect.String {
+		return fmt.Errorf("form: unsupported map key type %s", rv.Type().Key())
+	}
+	iter := rv.MapRange()
+	for iter.Next() {
+		key := joinKey(prefix, iter.Key().String())
+		if err := encodeValue(values, key, iter.Value(), fieldOptions{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeValue(values url.Values, key string, rv reflect.Value, opts fieldOptions) error {
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+
+	if rv.Type() == timeType {
+		values.Add(key, formatTime(rv.Interface().(time.Time), opts))
+		return nil
+	}
+	if rv.Type().Implements(textMarshalerType) {
+		text, err := rv.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+		values.Add(key, string(text))
+		return nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Struct:
+		return encodeStruct(values, key, rv)
+	case reflect.Map:
+		return encodeMap(values, key, rv)
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8 {
+			values.Add(key, string(rv.Bytes()))
+			return nil
+		}
+		for i := 0; i < rv.Len(); i++ {
+			elem := rv.Index(i)
+			elemKey := key
+			if isComposite(elem) {
+				elemKey = key + "[" + strconv.Itoa(i) + "]"
+			}
+			if err := encodeValue(values, elemKey, elem, opts); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	s, err := formatScalar(rv)
+	if err != nil {
+		return fmt.Errorf("form: field %s: %v", key, err)
+	}
+	values.Add(key, s)
+	return nil
+}
+
+func formatScalar(rv reflect.Value) (string, error) {
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(rv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Float32:
+		return strconv.FormatFloat(rv.Float(), 'f', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(rv.Float(), 'f', -1, 64), nil
+	}
+	return "", fmt.Errorf("unsupported type %s", rv.Type())
+}
+
+func formatTime(t time.Time, opts fieldOptions) string {
+	if opts.unix {
+		return strconv.FormatInt(t.Unix(), 10)
+	}
+	if opts.layout != "" {
+		return t.Format(opts.layout)
+	}
+	return t.Format(time.RFC3339)
+}
+
+// isComposite checks if value is encoded with multiple keys, in which case
+// it needs index when it is element of a slice.
+func isComposite(rv reflect.Value) bool {
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return false
+		}
+		rv = rv.Elem()
+	}
+	if rv.Type() == timeType || rv.Type().Implements(textMarshalerType) {
+		return false
+	}
+	return rv.Kind() == reflect.Struct || rv.Kind() == reflect.Map
+}
+
+func parseTag(tag string) (string, fieldOptions) {
+	var opts fieldOptions
+	parts := strings.Split(tag, ",")
+	for _, opt := range parts[1:] {
+		switch strings.TrimSpace(opt) {
+		case "omitempty":
+			opts.omitEmpty = true
+		case "unix":
+			opts.unix = true
+		}
+	}
+	return parts[0], opts
+}
+
+func joinKey(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "[" + name + "]"
+}
@@ -0,0 +1,124 @@
+package form_test
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/delicb/kioto/form"
+)
+
+type address struct {
+	City string `form:"city"`
+	Zip  string `form:"zip,omitempty"`
+}
+
+type Base struct {
+	ID int `form:"id"`
+}
+
+type level int
+
+func (l level) MarshalText() ([]byte, error) {
+	return []byte([]string{"low", "high"}[l]), nil
+}
+
+func TestEncodeStruct(t *testing.T) {
+	date := time.Date(2017, 3, 4, 5, 6, 7, 0, time.UTC)
+	type person struct {
+		Base
+		Name      string            `form:"name"`
+		Nickname  string            `form:"nickname,omitempty"`
+		NoTag     bool              ``
+		Age       uint8             `form:"age"`
+		Score     float64           `form:"score"`
+		Tags      []string          `form:"tag"`
+		Address   address           `form:"address"`
+		Previous  []address         `form:"previous"`
+		Work      *address          `form:"work"`
+		Born      time.Time         `form:"born"`
+		Day       time.Time         `form:"day" layout:"2006-01-02"`
+		Stamp     time.Time         `form:"stamp,unix"`
+		Missing   time.Time         `form:"missing,omitempty"`
+		Level     level             `form:"level"`
+		Labels    map[string]string `form:"labels"`
+		Ignored   string            `form:"-"`
+		unexposed string
+	}
+
+	values, err := form.Encode(&person{
+		Base:      Base{ID: 7},
+		Name:      "John",
+		NoTag:     true,
+		Age:       30,
+		Score:     1.5,
+		Tags:      []string{"a", "b"},
+		Address:   address{City: "Novi Sad"},
+		Previous:  []address{{City: "Belgrade", Zip: "11000"}},
+		Born:      date,
+		Day:       date,
+		Stamp:     date,
+		Level:     1,
+		Labels:    map[string]string{"k": "v"},
+		Ignored:   "ignored",
+		unexposed: "unexposed",
+	})
+	if err != nil {
+		t.Fatal("Unexpected error: ", err)
+	}
+
+	expected := url.Values{
+		"id":                {"7"},
+		"name":              {"John"},
+		"NoTag":             {"true"},
+		"age":               {"30"},
+		"score":             {"1.5"},
+		"tag":               {"a", "b"},
+		"address[city]":     {"Novi Sad"},
+		"previous[0][city]": {"Belgrade"},
+		"previous[0][zip]":  {"11000"},
+		"born":              {"2017-03-04T05:06:07Z"},
+		"day":               {"2017-03-04"},
+		"stamp":             {"1488603967"},
+		"level":             {"high"},
+		"labels[k]":         {"v"},
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Wrong values. Expected: %v, got: %v.", expected, values)
+	}
+}
+
+func TestEncodeMaps(t *testing.T) {
+	for _, data := range []struct {
+		Data     interface{}
+		Expected url.Values
+	}{
+		{url.Values{"a": {"1", "2"}}, url.Values{"a": {"1", "2"}}},
+		{map[string]string{"a": "1"}, url.Values{"a": {"1"}}},
+		{map[string][]string{"a": {"1", "2"}}, url.Values{"a": {"1", "2"}}},
+		{map[string]interface{}{"a": 1, "b": []int{2, 3}}, url.Values{"a": {"1"}, "b": {"2", "3"}}},
+		{(*address)(nil), url.Values{}},
+	} {
+		values, err := form.Encode(data.Data)
+		if err != nil {
+			t.Error("Unexpected error: ", err)
+		}
+		if !reflect.DeepEqual(values, data.Expected) {
+			t.Errorf("Wrong values. Expected: %v, got: %v.", data.Expected, values)
+		}
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	for _, data := range []interface{}{
+		"string",
+		42,
+		map[int]string{1: "a"},
+		struct{ C chan int }{C: make(chan int)},
+	} {
+		if _, err := form.Encode(data); err == nil {
+			t.Errorf("Expected error for %T, got nil.", data)
+		}
+	}
+}
@@ -1,5 +1,7 @@
 module github.com/delicb/kioto
 
+go 1.21
+
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/kr/pretty v0.1.0 // indirect
@@ -0,0 +1,109 @@
+// Package cassette contains recorder that records HTTP interactions to
+// cassette file and replays them later, so tests that talk to real services
+// can run offline and deterministically.
+//
+// Recorder implements both kioto.HTTPDoer and http.RoundTripper:
+//
+//	rec, err := cassette.New("testdata/users.json", cassette.SetMode(cassette.ReplayOnly))
+//	client := kioto.New(kioto.HTTPClient(rec))
+//
+// Secrets (Authorization and cookie headers by default) are scrubbed before
+// interactions are written to cassette.
+package cassette
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+)
+
+// Cassette holds recorded interactions. It is stored as JSON file.
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Interaction is one recorded request and response to it.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is recorded HTTP request.
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   Body        `json:"body,omitempty"`
+}
+
+// Response is recorded HTTP response.
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Status     string      `json:"status"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       Body        `json:"body,omitempty"`
+}
+
+// Body is recorded body of request or response. Valid UTF-8 body is stored
+// in cassette as string, so it is readable and easy to edit, while binary body
+// is stored encoded in base64.
+type Body []byte
+
+// MarshalJSON implements json.Marshaler interface.
+func (b Body) MarshalJSON() ([]byte, error) {
+	if utf8.Valid(b) {
+		return json.Marshal(string(b))
+	}
+	return json.Marshal(map[string]string{"base64": base64.StdEncoding.EncodeToString(b)})
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (b *Body) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*b = Body(text)
+		return nil
+	}
+	var encoded struct {
+		Base64 string `json:"base64"`
+	}
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded.Base64)
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// Load reads cassette from file with provided path.
+func Load(path string) (*Cassette, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cassette := &Cassette{}
+	if err := json.Unmarshal(data, cassette); err != nil {
+		return nil, err
+	}
+	return cassette, nil
+}
+
+// Save writes cassette to file with provided path, creating parent
+// directories if needed.
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
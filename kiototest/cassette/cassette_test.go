@@ -0,0 +1,180 @@
+package cassette_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/delicb/kioto"
+	"github.com/delicb/kioto/kiototest/cassette"
+	"github.com/delicb/kioto/middlewares/body"
+)
+
+type testServer struct {
+	*httptest.Server
+	calls int32
+}
+
+func newServer() *testServer {
+	s := &testServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&s.calls, 1)
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.Header().Set("X-Call", string('0'+byte(n)))
+		if r.URL.Path == "/binary" {
+			w.Write([]byte{0xff, 0x00, 0xfe})
+			return
+		}
+		fmt.Fprintf(w, `{"path": %q, "token": "abc"}`, r.URL.Path)
+	}))
+	return s
+}
+
+func tempCassette(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "kioto-cassette")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "fixtures", "cassette.json")
+}
+
+func send(t *testing.T, doer kioto.HTTPDoer, method, url, data string) (*kioto.Response, string) {
+	client := kioto.New(kioto.HTTPClient(doer))
+	req := client.Request().Method(method).URL(url).Header("Authorization", "Bearer token")
+	if data != "" {
+		req.Use(body.String(data))
+	}
+	resp, err := req.Send()
+	require.NoError(t, err)
+	text, err := resp.String()
+	require.NoError(t, err)
+	return resp, text
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+	path := tempCassette(t)
+
+	rec, err := cassette.New(path, cassette.Scrub(cassette.ScrubQuery("key")))
+	require.NoError(t, err)
+	_, first := send(t, rec, "GET", server.URL+"/users?key=k1&page=1", "")
+	_, binary := send(t, rec, "GET", server.URL+"/binary", "")
+	assert.Equal(t, int32(2), server.calls)
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "Bearer token")
+	assert.NotContains(t, string(data), "session=secret")
+	assert.NotContains(t, string(data), "k1")
+	assert.Contains(t, string(data), `"base64"`)
+
+	replay, err := cassette.New(path, cassette.SetMode(cassette.ReplayOnly), cassette.Scrub(cassette.ScrubQuery("key")))
+	require.NoError(t, err)
+	resp, replayed := send(t, replay, "GET", server.URL+"/users?page=1&key=other", "")
+	assert.Equal(t, first, replayed)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "1", resp.Header.Get("X-Call"))
+	assert.Equal(t, cassette.Redacted, resp.Header.Get("Set-Cookie"))
+	_, replayedBinary := send(t, replay, "GET", server.URL+"/binary", "")
+	assert.Equal(t, binary, replayedBinary)
+	assert.Equal(t, int32(2), server.calls, "replay sent request over the wire")
+
+	_, err = replay.Do(mustRequest(t, "GET", server.URL+"/missing"))
+	assert.True(t, errors.Is(err, cassette.ErrInteractionNotFound))
+}
+
+func mustRequest(t *testing.T, method, url string) *http.Request {
+	req, err := http.NewRequest(method, url, nil)
+	require.NoError(t, err)
+	return req
+}
+
+func TestRecordNewEpisodes(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+	path := tempCassette(t)
+
+	rec, err := cassette.New(path)
+	require.NoError(t, err)
+	send(t, rec, "GET", server.URL+"/a", "")
+
+	rec, err = cassette.New(path)
+	require.NoError(t, err)
+	resp, _ := send(t, rec, "GET", server.URL+"/a", "")
+	assert.Equal(t, "1", resp.Header.Get("X-Call"))
+	resp, _ = send(t, rec, "GET", server.URL+"/b", "")
+	assert.Equal(t, "2", resp.Header.Get("X-Call"))
+	assert.Equal(t, int32(2), server.calls)
+
+	loaded, err := cassette.Load(path)
+	require.NoError(t, err)
+	assert.Len(t, loaded.Interactions, 2)
+}
+
+func TestRecordOnly(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+	path := tempCassette(t)
+
+	for i := 0; i < 2; i++ {
+		rec, err := cassette.New(path, cassette.SetMode(cassette.RecordOnly))
+		require.NoError(t, err)
+		send(t, rec, "GET", server.URL+"/a", "")
+	}
+	assert.Equal(t, int32(2), server.calls)
+	loaded, err := cassette.Load(path)
+	require.NoError(t, err)
+	require.Len(t, loaded.Interactions, 1, "cassette not replaced")
+	assert.Equal(t, "2", loaded.Interactions[0].Response.Header.Get("X-Call"))
+}
+
+func TestReplayOnlyMissingCassette(t *testing.T) {
+	_, err := cassette.New(tempCassette(t), cassette.SetMode(cassette.ReplayOnly))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestMatchBodyAndSequence(t *testing.T) {
+	server := newServer()
+	defer server.Close()
+	path := tempCassette(t)
+	matcher := cassette.MatchAll(cassette.DefaultMatcher, cassette.MatchBody)
+	scrub := cassette.Scrub(cassette.ScrubJSONFields("password", "token"))
+
+	rec, err := cassette.New(path, cassette.SetMatcher(matcher), scrub)
+	require.NoError(t, err)
+	client := &http.Client{Transport: rec}
+	_, first := send(t, client, "POST", server.URL+"/login", `{"user": "a", "password": "p1"}`)
+	send(t, client, "POST", server.URL+"/login", `{"user": "a", "password": "p1"}`)
+	send(t, client, "POST", server.URL+"/login", `{"user": "b", "password": "p2"}`)
+	assert.Contains(t, first, `"token": "abc"`)
+	assert.Equal(t, int32(3), server.calls, "repeated request not recorded")
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "p1")
+	assert.NotContains(t, string(data), "abc")
+
+	replay, err := cassette.New(path, cassette.SetMode(cassette.ReplayOnly), cassette.SetMatcher(matcher), scrub)
+	require.NoError(t, err)
+	for _, expected := range []string{"1", "2", "2"} {
+		resp, _ := send(t, replay, "POST", server.URL+"/login", `{"password": "other", "user": "a"}`)
+		assert.Equal(t, expected, resp.Header.Get("X-Call"))
+	}
+	resp, _ := send(t, replay, "POST", server.URL+"/login", `{"user": "b", "password": "p2"}`)
+	assert.Equal(t, "3", resp.Header.Get("X-Call"))
+
+	req, err := http.NewRequest("POST", server.URL+"/login", strings.NewReader(`{"user": "c"}`))
+	require.NoError(t, err)
+	_, err = replay.Do(req)
+	assert.True(t, errors.Is(err, cassette.ErrInteractionNotFound))
+}
@@ -0,0 +1,59 @@
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"reflect"
+)
+
+// Matcher reports if incoming request matches recorded one. Incoming request
+// is scrubbed the same way recorded requests are, so scrubbed values match.
+type Matcher func(incoming, recorded *Request) bool
+
+// DefaultMatcher matches requests by method and URL.
+var DefaultMatcher = MatchAll(MatchMethod, MatchURL)
+
+// MatchAll returns matcher that matches if all provided matchers match.
+func MatchAll(matchers ...Matcher) Matcher {
+	return func(incoming, recorded *Request) bool {
+		for _, m := range matchers {
+			if !m(incoming, recorded) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// MatchMethod matches requests with same method.
+func MatchMethod(incoming, recorded *Request) bool {
+	return incoming.Method == recorded.Method
+}
+
+// MatchURL matches requests with same URL. Order of query parameters is
+// ignored.
+func MatchURL(incoming, recorded *Request) bool {
+	a, errA := url.Parse(incoming.URL)
+	b, errB := url.Parse(recorded.URL)
+	if errA != nil || errB != nil {
+		return incoming.URL == recorded.URL
+	}
+	if a.Scheme != b.Scheme || a.Host != b.Host || a.Path != b.Path {
+		return false
+	}
+	return reflect.DeepEqual(a.Query(), b.Query())
+}
+
+// MatchBody matches requests with same body. JSON bodies are compared by
+// value, so formatting and order of object keys are ignored.
+func MatchBody(incoming, recorded *Request) bool {
+	if bytes.Equal(incoming.Body, recorded.Body) {
+		return true
+	}
+	var a, b interface{}
+	if json.Unmarshal(incoming.Body, &a) != nil || json.Unmarshal(recorded.Body, &b) != nil {
+		return false
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,272 @@
+package cassette
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// ErrInteractionNotFound is returned in ReplayOnly mode when cassette does
+// not contain interaction matching request.
+var ErrInteractionNotFound = errors.New("cassette: no matching interaction")
+
+// Mode defines if recorder sends requests over the wire or replays them from
+// cassette.
+type Mode int
+
+const (
+	// RecordNewEpisodes replays interactions found in cassette and records
+	// requests that are not found. This is default mode, so first run records
+	// cassette and subsequent runs replay it.
+	RecordNewEpisodes Mode = iota
+	// RecordOnly sends all requests over the wire and records them,
+	// replacing existing cassette.
+	RecordOnly
+	// ReplayOnly replays interactions from cassette and fails requests that
+	// are not found in it, without sending them.
+	ReplayOnly
+)
+
+// Option configures Recorder.
+type Option func(*Recorder)
+
+// SetMode sets recorder mode. Default is RecordNewEpisodes.
+func SetMode(mode Mode) Option {
+	return func(r *Recorder) {
+		r.mode = mode
+	}
+}
+
+// SetMatcher sets matcher used to find recorded interaction for request.
+// Default is DefaultMatcher.
+func SetMatcher(matcher Matcher) Option {
+	return func(r *Recorder) {
+		r.matcher = matcher
+	}
+}
+
+// Scrub adds scrubbers applied to interactions before they are recorded,
+// on top of DefaultScrubber.
+func Scrub(scrubbers ...Scrubber) Option {
+	return func(r *Recorder) {
+		r.scrubbers = append(r.scrubbers, scrubbers...)
+	}
+}
+
+// Transport sets RoundTripper used to send requests that are recorded.
+// Default is http.DefaultTransport.
+func Transport(transport http.RoundTripper) Option {
+	return func(r *Recorder) {
+		r.transport = transport
+	}
+}
+
+// Recorder records HTTP interactions to cassette and replays them. It
+// implements kioto.HTTPDoer, so it can be used with kioto.HTTPClient
+// option, and http.RoundTripper, so it can be used as transport of
+// http.Client (e.g. to keep retries and redirects).
+type Recorder struct {
+	path      string
+	mode      Mode
+	matcher   Matcher
+	scrubbers []Scrubber
+	transport http.RoundTripper
+
+	mu       sync.Mutex
+	cassette *Cassette
+	used     map[*Interaction]bool
+}
+
+// New creates recorder that uses cassette file with provided path. Cassette
+// is loaded if file exists, and it must exist in ReplayOnly mode. New
+// interactions are written to file as they are recorded.
+func New(path string, opts ...Option) (*Recorder, error) {
+	r := &Recorder{
+		path:      path,
+		matcher:   DefaultMatcher,
+		scrubbers: []Scrubber{DefaultScrubber},
+		transport: http.DefaultTransport,
+		cassette:  &Cassette{},
+		used:      make(map[*Interaction]bool),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.mode == RecordOnly {
+		return r, nil
+	}
+
+	cassette, err := Load(path)
+	if os.IsNotExist(err) && r.mode != ReplayOnly {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.cassette = cassette
+	return r, nil
+}
+
+// Do implements kioto.HTTPDoer interface.
+func (r *Recorder) Do(req *http.Request) (*http.Response, error) {
+	return r.RoundTrip(req)
+}
+
+// RoundTrip implements http.RoundTripper interface. Depending on mode, it
+// returns recorded response or sends request and records it.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+	incoming := &Interaction{Request: Request{
+		Method: req.Method,
+		URL:    req.URL.String(),
+		Header: req.Header.Clone(),
+		Body:   reqBody,
+	}}
+	r.scrub(incoming)
+
+	if r.mode != RecordOnly {
+		if recorded := r.find(&incoming.Request); recorded != nil {
+			return replay(recorded, req), nil
+		}
+		if r.mode == ReplayOnly {
+			return nil, fmt.Errorf("%w: %s %s", ErrInteractionNotFound, req.Method, req.URL)
+		}
+	}
+	return r.record(req, reqBody)
+}
+
+// Cassette returns copy of interactions recorded or loaded so far.
+func (r *Recorder) Cassette() *Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	interactions := make([]*Interaction, len(r.cassette.Interactions))
+	copy(interactions, r.cassette.Interactions)
+	return &Cassette{Interactions: interactions}
+}
+
+// find returns interaction matching request. Each interaction is replayed
+// once, so sequence of same requests replays recorded sequence of responses.
+// In ReplayOnly mode, when all matching interactions are replayed, last one is
+// replayed again, while in other modes request is recorded.
+func (r *Recorder) find(req *Request) *Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var fallback *Interaction
+	for _, i := range r.cassette.Interactions {
+		if !r.matcher(req, &i.Request) {
+			continue
+		}
+		if !r.used[i] {
+			r.used[i] = true
+			return i
+		}
+		fallback = i
+	}
+	if r.mode != ReplayOnly {
+		return nil
+	}
+	return fallback
+}
+
+func (r *Recorder) record(req *http.Request, reqBody []byte) (*http.Response, error) {
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := readAll(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	interaction := &Interaction{
+		Request: Request{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: req.Header.Clone(),
+			Body:   reqBody,
+		},
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Header:     resp.Header.Clone(),
+			Body:       respBody,
+		},
+	}
+	r.scrub(interaction)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	r.used[interaction] = true
+	if err := r.cassette.Save(r.path); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (r *Recorder) scrub(i *Interaction) {
+	for _, s := range r.scrubbers {
+		s(i)
+	}
+}
+
+// replay creates response from recorded interaction.
+func replay(i *Interaction, req *http.Request) *http.Response {
+	header := i.Response.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	status := i.Response.Status
+	if status == "" {
+		status = fmt.Sprintf("%d %s", i.Response.StatusCode, http.StatusText(i.Response.StatusCode))
+	}
+	return &http.Response{
+		Status:        status,
+		StatusCode:    i.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(i.Response.Body)),
+		ContentLength: int64(len(i.Response.Body)),
+		Request:       req,
+	}
+}
+
+// readBody reads request body and replaces it with copy, so request can
+// still be sent.
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	data, err := ioutil.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
+
+// readAll reads response body and replaces it with copy, so caller can
+// still read it.
+func readAll(resp *http.Response) ([]byte, error) {
+	if resp.Body == nil {
+		return nil, nil
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
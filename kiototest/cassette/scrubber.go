@@ -0,0 +1,108 @@
+package cassette
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Redacted is value that replaces scrubbed secrets.
+const Redacted = "[REDACTED]"
+
+// Scrubber removes secrets from interaction before it is written to
+// cassette.
+type Scrubber func(*Interaction)
+
+// DefaultScrubber scrubs headers that usually hold credentials.
+var DefaultScrubber = ScrubHeaders("Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie")
+
+// ScrubHeaders replaces values of provided request and response headers.
+func ScrubHeaders(names ...string) Scrubber {
+	return func(i *Interaction) {
+		for _, name := range names {
+			scrubHeader(i.Request.Header, name)
+			scrubHeader(i.Response.Header, name)
+		}
+	}
+}
+
+func scrubHeader(header http.Header, name string) {
+	values := header[http.CanonicalHeaderKey(name)]
+	for i := range values {
+		values[i] = Redacted
+	}
+}
+
+// ScrubQuery replaces values of provided query parameters in request URL.
+func ScrubQuery(params ...string) Scrubber {
+	return func(i *Interaction) {
+		u, err := url.Parse(i.Request.URL)
+		if err != nil {
+			return
+		}
+		query := u.Query()
+		changed := false
+		for _, param := range params {
+			values := query[param]
+			for j := range values {
+				values[j] = Redacted
+				changed = true
+			}
+		}
+		if changed {
+			u.RawQuery = query.Encode()
+			i.Request.URL = u.String()
+		}
+	}
+}
+
+// ScrubJSONFields replaces values of fields with provided names (case
+// insensitive, on any level of nesting) in JSON request and response bodies.
+func ScrubJSONFields(fields ...string) Scrubber {
+	names := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		names[strings.ToLower(f)] = true
+	}
+	return func(i *Interaction) {
+		i.Request.Body = scrubJSON(i.Request.Body, names)
+		i.Response.Body = scrubJSON(i.Response.Body, names)
+	}
+}
+
+func scrubJSON(body Body, names map[string]bool) Body {
+	var v interface{}
+	if len(body) == 0 || json.Unmarshal(body, &v) != nil {
+		return body
+	}
+	if !scrubValue(v, names) {
+		return body
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return body
+	}
+	return data
+}
+
+// scrubValue replaces fields with provided names in decoded JSON value and
+// reports if anything was replaced.
+func scrubValue(v interface{}, names map[string]bool) bool {
+	changed := false
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if names[strings.ToLower(key)] {
+				v[key] = Redacted
+				changed = true
+				continue
+			}
+			changed = scrubValue(value, names) || changed
+		}
+	case []interface{}:
+		for _, value := range v {
+			changed = scrubValue(value, names) || changed
+		}
+	}
+	return changed
+}
@@ -0,0 +1,341 @@
+// Package kiototest contains utilities for testing code that uses kioto
+// client, without starting HTTP servers.
+//
+// Doer is fake kioto.HTTPDoer that returns scripted responses for expected
+// requests:
+//
+//	doer := kiototest.NewDoer(t)
+//	doer.Expect("GET", "/users/*").WithQuery("active", "true").RespondJSON(200, users)
+//	doer.Expect("POST", "/users").WithJSONBody(newUser).Respond(201, "")
+//	client := kioto.New(kioto.HTTPClient(doer))
+//
+// Requests that do not match any expectation and expectations that were not
+// met when test finishes are reported as test errors.
+package kiototest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Doer is fake HTTP doer that can be used with kioto.HTTPClient option. It
+// also implements http.RoundTripper, so it can be used as transport of
+// http.Client, e.g. to test retries.
+type Doer struct {
+	t            testing.TB
+	mu           sync.Mutex
+	expectations []*Expectation
+	requests     []*http.Request
+}
+
+// NewDoer creates new fake doer that reports failures to provided test.
+// When test finishes, expectations that were not met are reported.
+func NewDoer(t testing.TB) *Doer {
+	d := &Doer{t: t}
+	t.Cleanup(func() {
+		d.AssertExpectations()
+	})
+	return d
+}
+
+// Expect adds expectation for request with provided method and URL pattern.
+// Empty method or "*" matches any method. URL pattern is matched as in
+// path.Match, against request path if pattern starts with "/" or against
+// whole URL without query otherwise. Expectations are checked in order in
+// which they were added.
+func (d *Doer) Expect(method, urlPattern string) *Expectation {
+	e := &Expectation{
+		method:  strings.ToUpper(method),
+		pattern: urlPattern,
+		query:   make(map[string][]string),
+		header:  make(map[string][]string),
+	}
+	d.mu.Lock()
+	d.expectations = append(d.expectations, e)
+	d.mu.Unlock()
+	return e
+}
+
+// Do implements kioto.HTTPDoer interface. It returns next response queued for
+// first expectation that matches request. If no expectation matches, test
+// error is reported and error is returned.
+func (d *Doer) Do(req *http.Request) (*http.Response, error) {
+	d.t.Helper()
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	d.requests = append(d.requests, req)
+	var match *Expectation
+	var reply *reply
+	for _, e := range d.expectations {
+		if e.exhausted() || !e.matches(req, body) {
+			continue
+		}
+		match = e
+		reply = e.next()
+		break
+	}
+	d.mu.Unlock()
+
+	if match == nil {
+		err := fmt.Errorf("kiototest: unexpected request %s %s", req.Method, req.URL)
+		d.t.Errorf("%v", err)
+		return nil, err
+	}
+	if reply.err != nil {
+		return nil, reply.err
+	}
+	return reply.response(req), nil
+}
+
+// RoundTrip implements http.RoundTripper interface.
+func (d *Doer) RoundTrip(req *http.Request) (*http.Response, error) {
+	d.t.Helper()
+	return d.Do(req)
+}
+
+// Requests returns all requests received by doer, in order.
+func (d *Doer) Requests() []*http.Request {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	requests := make([]*http.Request, len(d.requests))
+	copy(requests, d.requests)
+	return requests
+}
+
+// AssertExpectations reports test error for each expectation that did not
+// receive all requests it expected and returns false if there was any.
+// It is called automatically when test finishes.
+func (d *Doer) AssertExpectations() bool {
+	d.t.Helper()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ok := true
+	for _, e := range d.expectations {
+		if !e.exhausted() {
+			d.t.Errorf("kiototest: expected %s, got %d of %d calls", e, e.calls, e.times())
+			ok = false
+		}
+	}
+	return ok
+}
+
+// Expectation describes expected request and responses to return for it.
+type Expectation struct {
+	method   string
+	pattern  string
+	query    map[string][]string
+	header   map[string][]string
+	jsonBody interface{}
+	hasJSON  bool
+	matchers []func(*http.Request) bool
+
+	replies []*reply
+	calls   int
+}
+
+// WithQuery requires request to have query parameter with provided value.
+func (e *Expectation) WithQuery(key, value string) *Expectation {
+	e.query[key] = append(e.query[key], value)
+	return e
+}
+
+// WithHeader requires request to have header with provided value.
+func (e *Expectation) WithHeader(key, value string) *Expectation {
+	key = http.CanonicalHeaderKey(key)
+	e.header[key] = append(e.header[key], value)
+	return e
+}
+
+// WithJSONBody requires request body to be JSON equal to provided value
+// encoded to JSON. Formatting and order of object keys are ignored.
+func (e *Expectation) WithJSONBody(v interface{}) *Expectation {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("kiototest: encoding expected JSON body: %v", err))
+	}
+	var expected interface{}
+	_ = json.Unmarshal(data, &expected)
+	e.jsonBody = expected
+	e.hasJSON = true
+	return e
+}
+
+// Match requires request to satisfy provided function.
+func (e *Expectation) Match(matcher func(req *http.Request) bool) *Expectation {
+	e.matchers = append(e.matchers, matcher)
+	return e
+}
+
+// Respond queues response with provided status code and body.
+func (e *Expectation) Respond(status int, body string) *Expectation {
+	return e.RespondWith(status, nil, []byte(body))
+}
+
+// RespondJSON queues response with provided status code and value encoded
+// to JSON as body.
+func (e *Expectation) RespondJSON(status int, v interface{}) *Expectation {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("kiototest: encoding JSON response: %v", err))
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	return e.RespondWith(status, header, data)
+}
+
+// RespondWith queues response with provided status code, headers and body.
+func (e *Expectation) RespondWith(status int, header http.Header, body []byte) *Expectation {
+	e.replies = append(e.replies, &reply{status: status, header: header, body: body})
+	return e
+}
+
+// RespondError queues error to be returned instead of response.
+func (e *Expectation) RespondError(err error) *Expectation {
+	e.replies = append(e.replies, &reply{err: err})
+	return e
+}
+
+// String returns description of expected request.
+func (e *Expectation) String() string {
+	method := e.method
+	if method == "" {
+		method = "*"
+	}
+	return method + " " + e.pattern
+}
+
+// times returns number of requests expectation expects. Expectation without
+// queued responses expects single request, and responds with empty 200 OK.
+func (e *Expectation) times() int {
+	if len(e.replies) == 0 {
+		return 1
+	}
+	return len(e.replies)
+}
+
+func (e *Expectation) exhausted() bool {
+	return e.calls >= e.times()
+}
+
+func (e *Expectation) next() *reply {
+	e.calls++
+	if len(e.replies) == 0 {
+		return &reply{status: http.StatusOK}
+	}
+	return e.replies[e.calls-1]
+}
+
+func (e *Expectation) matches(req *http.Request, body []byte) bool {
+	if e.method != "" && e.method != "*" && e.method != req.Method {
+		return false
+	}
+	if !matchURL(e.pattern, req) {
+		return false
+	}
+	query := req.URL.Query()
+	for key, values := range e.query {
+		for _, v := range values {
+			if !contains(query[key], v) {
+				return false
+			}
+		}
+	}
+	for key, values := range e.header {
+		for _, v := range values {
+			if !contains(req.Header[key], v) {
+				return false
+			}
+		}
+	}
+	if e.hasJSON {
+		var actual interface{}
+		if err := json.Unmarshal(body, &actual); err != nil {
+			return false
+		}
+		if !reflect.DeepEqual(e.jsonBody, actual) {
+			return false
+		}
+	}
+	for _, matcher := range e.matchers {
+		if !matcher(req) {
+			return false
+		}
+	}
+	return true
+}
+
+type reply struct {
+	status int
+	header http.Header
+	body   []byte
+	err    error
+}
+
+func (r *reply) response(req *http.Request) *http.Response {
+	header := http.Header{}
+	for k, v := range r.header {
+		header[k] = append([]string(nil), v...)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.status, http.StatusText(r.status)),
+		StatusCode:    r.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(r.body)),
+		ContentLength: int64(len(r.body)),
+		Request:       req,
+	}
+}
+
+// readBody reads request body and replaces it with copy, so that it can be
+// matched multiple times and inspected later.
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	data, err := ioutil.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
+
+func matchURL(pattern string, req *http.Request) bool {
+	target := req.URL.Path
+	if !strings.HasPrefix(pattern, "/") {
+		u := *req.URL
+		u.RawQuery = ""
+		u.Fragment = ""
+		target = u.String()
+	}
+	if target == "" {
+		target = "/"
+	}
+	matched, err := path.Match(pattern, target)
+	return err == nil && matched
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
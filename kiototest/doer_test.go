@@ -0,0 +1,129 @@
+package kiototest_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/delicb/kioto"
+	"github.com/delicb/kioto/kiototest"
+	"github.com/delicb/kioto/middlewares/body"
+	"github.com/delicb/kioto/middlewares/retry"
+)
+
+// fakeTB records errors instead of failing test.
+type fakeTB struct {
+	testing.TB
+	errors   []string
+	cleanups []func()
+}
+
+func (f *fakeTB) Helper() {}
+
+func (f *fakeTB) Errorf(format string, args ...interface{}) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeTB) Cleanup(fn func()) {
+	f.cleanups = append(f.cleanups, fn)
+}
+
+func (f *fakeTB) finish() {
+	for _, fn := range f.cleanups {
+		fn()
+	}
+}
+
+func TestDoer(t *testing.T) {
+	doer := kiototest.NewDoer(t)
+	doer.Expect("GET", "/users/*").
+		WithQuery("active", "true").
+		WithHeader("x-token", "secret").
+		RespondJSON(200, map[string]string{"name": "John"})
+	doer.Expect("POST", "http://example.com/users").
+		WithJSONBody(map[string]interface{}{"name": "Jane", "age": 30}).
+		Respond(201, "created")
+
+	client := kioto.New(kioto.HTTPClient(doer))
+	resp, err := client.Request().Get().URL("http://example.com/users/1?active=true").Header("X-Token", "secret").Send()
+	require.NoError(t, err)
+	result := map[string]string{}
+	require.NoError(t, resp.Decode(&result))
+	assert.Equal(t, "John", result["name"])
+
+	resp, err = client.Request().Post().URL("http://example.com/users").
+		Use(body.String(`{"age": 30, "name": "Jane"}`)).Send()
+	require.NoError(t, err)
+	assert.Equal(t, 201, resp.StatusCode)
+	assert.Equal(t, "201 Created", resp.Status)
+	text, err := resp.String()
+	require.NoError(t, err)
+	assert.Equal(t, "created", text)
+
+	requests := doer.Requests()
+	require.Len(t, requests, 2)
+	assert.Equal(t, "POST", requests[1].Method)
+}
+
+func TestDoerQueuedResponses(t *testing.T) {
+	doer := kiototest.NewDoer(t)
+	myErr := errors.New("connection reset")
+	doer.Expect("", "/data").
+		RespondError(myErr).
+		Respond(503, "").
+		Respond(200, "ok")
+
+	client := kioto.New(kioto.HTTPClient(&http.Client{Transport: doer}))
+	resp, err := client.Request().Get().URL("http://example.com/data").Use(
+		retry.Times(2),
+		retry.SetClassifier(func(resp *http.Response, err error) bool {
+			return err != nil || resp.StatusCode >= 500
+		}),
+		retry.SetBackoffStrategy(retry.ConstantBackoff(time.Millisecond)),
+	).Send()
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Len(t, doer.Requests(), 3)
+}
+
+func TestDoerFailures(t *testing.T) {
+	tb := &fakeTB{}
+	doer := kiototest.NewDoer(tb)
+	doer.Expect("GET", "/expected").Respond(200, "").Respond(200, "")
+	doer.Expect("POST", "/never")
+	doer.Expect("PUT", "/body").WithJSONBody([]int{1, 2})
+
+	client := kioto.New(kioto.HTTPClient(doer))
+	_, err := client.Request().Get().URL("http://example.com/expected").Send()
+	require.NoError(t, err)
+	_, err = client.Request().Get().URL("http://example.com/unexpected").Send()
+	assert.Error(t, err)
+	_, err = client.Request().Put().URL("http://example.com/body").Use(body.String("[2, 1]")).Send()
+	assert.Error(t, err)
+
+	tb.finish()
+	require.Len(t, tb.errors, 5, strings.Join(tb.errors, "\n"))
+	assert.Contains(t, tb.errors[0], "unexpected request GET http://example.com/unexpected")
+	assert.Contains(t, tb.errors[1], "unexpected request PUT http://example.com/body")
+	assert.Contains(t, tb.errors[2], "expected GET /expected, got 1 of 2 calls")
+	assert.Contains(t, tb.errors[3], "expected POST /never, got 0 of 1 calls")
+	assert.Contains(t, tb.errors[4], "expected PUT /body, got 0 of 1 calls")
+}
+
+func TestDoerMatch(t *testing.T) {
+	doer := kiototest.NewDoer(t)
+	doer.Expect("*", "http://*.example.com/*").Match(func(req *http.Request) bool {
+		return req.Method == "DELETE"
+	}).RespondWith(204, http.Header{"X-Deleted": {"yes"}}, nil)
+
+	resp, err := kioto.New(kioto.HTTPClient(doer)).Request().Delete().URL("http://api.example.com/item").Send()
+	require.NoError(t, err)
+	assert.Equal(t, 204, resp.StatusCode)
+	assert.Equal(t, "yes", resp.Header.Get("X-Deleted"))
+}
@@ -0,0 +1,332 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/md5" // nolint: gosec
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	c "github.com/delicb/kioto/cliware"
+)
+
+// quotedStringEscaper escapes characters that can not appear unescaped in
+// quoted-string.
+var quotedStringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// Digest sets HTTP Digest authentication (RFC 7616) to request. Request is
+// first sent without authorization (or with authorization based on previous
+// challenge) and if server responds with 401 and Digest challenge, request
+// is sent again with computed credentials. Nonce received from server is
+// remembered per scheme and host, so later requests to the same host are
+// authenticated in advance, while requests to other hosts are not. Only
+// qop=auth (or no qop) with MD5 and SHA-256 algorithms is supported.
+//
+// Since middleware needs request URL, when added to client it should be
+// added with Client.UsePost. Since request might have to be sent twice,
+// request body is read into memory before sending, unless request has
+// GetBody set.
+func Digest(username, password string) c.Middleware {
+	d := &digestAuth{
+		username: username,
+		password: password,
+		cnonce:   randomCnonce,
+		spaces:   make(map[string]*digestState),
+	}
+	return c.MiddlewareFunc(d.exec)
+}
+
+type digestChallenge struct {
+	realm     string
+	nonce     string
+	opaque    string
+	algorithm string
+	qop       string
+	stale     bool
+}
+
+// digestState holds last challenge received for a protection space and
+// number of times its nonce was used.
+type digestState struct {
+	challenge *digestChallenge
+	nc        uint32
+}
+
+type digestAuth struct {
+	username string
+	password string
+	cnonce   func() string
+
+	mu     sync.Mutex
+	spaces map[string]*digestState
+}
+
+func (d *digestAuth) exec(next c.Handler) c.Handler {
+	return c.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		getBody, err := replayableBody(req)
+		if err != nil {
+			return nil, err
+		}
+
+		space := protectionSpace(req)
+		sentNonce := ""
+		if challenge, nc := d.next(space); challenge != nil {
+			authorization, err := d.authorization(challenge, req, nc, d.cnonce())
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Authorization", authorization)
+			sentNonce = challenge.nonce
+		}
+
+		resp, err := next.Handle(req)
+		if err != nil || resp.StatusCode != http.StatusUnauthorized {
+			return resp, err
+		}
+
+		challenge := parseDigestChallenge(resp.Header)
+		// if server rejected fresh nonce, credentials are wrong and there
+		// is no point in trying again
+		if challenge == nil || (challenge.nonce == sentNonce && !challenge.stale) {
+			return resp, err
+		}
+
+		nc := d.reset(space, challenge)
+		authorization, err := d.authorization(challenge, req, nc, d.cnonce())
+		if err != nil {
+			return resp, err
+		}
+
+		_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+		_ = resp.Body.Close()
+
+		retryReq := req.Clone(req.Context())
+		if getBody != nil {
+			if retryReq.Body, err = getBody(); err != nil {
+				return nil, err
+			}
+		}
+		retryReq.Header.Set("Authorization", authorization)
+		return next.Handle(retryReq)
+	})
+}
+
+// protectionSpace returns key under which challenge for request is stored.
+// Empty string is returned if request has no host, in which case challenge
+// is not stored.
+func protectionSpace(req *http.Request) string {
+	if req.URL == nil || req.URL.Host == "" {
+		return ""
+	}
+	return strings.ToLower(req.URL.Scheme + "://" + req.URL.Host)
+}
+
+// next returns current challenge for provided protection space and nonce
+// count to use with it, or nil if there was no challenge.
+func (d *digestAuth) next(space string) (*digestChallenge, uint32) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	state, ok := d.spaces[space]
+	if !ok || space == "" {
+		return nil, 0
+	}
+	state.nc++
+	return state.challenge, state.nc
+}
+
+// reset replaces challenge for provided protection space with new one and
+// returns nonce count for its first use.
+func (d *digestAuth) reset(space string, challenge *digestChallenge) uint32 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if space != "" {
+		d.spaces[space] = &digestState{challenge: challenge, nc: 1}
+	}
+	return 1
+}
+
+// authorization computes value of Authorization header for provided request.
+func (d *digestAuth) authorization(challenge *digestChallenge, req *http.Request, nc uint32, cnonce string) (string, error) {
+	var h func() hash.Hash
+	algorithm := strings.ToUpper(challenge.algorithm)
+	switch strings.TrimSuffix(algorithm, "-SESS") {
+	case "", "MD5":
+		h = md5.New
+	case "SHA-256":
+		h = sha256.New
+	default:
+		return "", fmt.Errorf("digest auth: unsupported algorithm %q", challenge.algorithm)
+	}
+	hashHex := func(parts ...string) string {
+		hh := h()
+		_, _ = io.WriteString(hh, strings.Join(parts, ":"))
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+
+	qop := ""
+	if challenge.qop != "" {
+		for _, option := range strings.Split(challenge.qop, ",") {
+			if strings.TrimSpace(option) == "auth" {
+				qop = "auth"
+			}
+		}
+		if qop == "" {
+			return "", fmt.Errorf("digest auth: unsupported qop %q", challenge.qop)
+		}
+	}
+
+	uri := req.URL.RequestURI()
+	ncValue := fmt.Sprintf("%08x", nc)
+	ha1 := hashHex(d.username, challenge.realm, d.password)
+	if strings.HasSuffix(algorithm, "-SESS") {
+		ha1 = hashHex(ha1, challenge.nonce, cnonce)
+	}
+	ha2 := hashHex(req.Method, uri)
+
+	var response string
+	if qop == "" {
+		response = hashHex(ha1, challenge.nonce, ha2)
+	} else {
+		response = hashHex(ha1, challenge.nonce, ncValue, cnonce, qop, ha2)
+	}
+
+	parts := []string{
+		"username=" + quoteString(d.username),
+		"realm=" + quoteString(challenge.realm),
+		"uri=" + quoteString(uri),
+	}
+	if challenge.algorithm != "" {
+		parts = append(parts, "algorithm="+challenge.algorithm)
+	}
+	parts = append(parts, "nonce="+quoteString(challenge.nonce))
+	if qop != "" {
+		parts = append(parts, "nc="+ncValue, "cnonce="+quoteString(cnonce), "qop="+qop)
+	}
+	parts = append(parts, "response="+quoteString(response))
+	if challenge.opaque != "" {
+		parts = append(parts, "opaque="+quoteString(challenge.opaque))
+	}
+	return "Digest " + strings.Join(parts, ", "), nil
+}
+
+// quoteString returns provided value as quoted-string (RFC 7230 section
+// 3.2.6). Only backslash and double quote are escaped, other bytes
+// (including non-ASCII ones) are sent as they are, since server hashes
+// unescaped value.
+func quoteString(s string) string {
+	return `"` + quotedStringEscaper.Replace(s) + `"`
+}
+
+// parseDigestChallenge finds Digest challenge in WWW-Authenticate headers
+// and parses it. Nil is returned if there is no Digest challenge.
+func parseDigestChallenge(header http.Header) *digestChallenge {
+	for _, value := range header.Values("WWW-Authenticate") {
+		for value != "" {
+			var scheme string
+			var params map[string]string
+			scheme, params, value = parseChallenge(value)
+			if !strings.EqualFold(scheme, "digest") || params["nonce"] == "" {
+				continue
+			}
+			return &digestChallenge{
+				realm:     params["realm"],
+				nonce:     params["nonce"],
+				opaque:    params["opaque"],
+				algorithm: params["algorithm"],
+				qop:       params["qop"],
+				stale:     strings.EqualFold(params["stale"], "true"),
+			}
+		}
+	}
+	return nil
+}
+
+// parseChallenge parses first challenge (auth scheme followed by its
+// parameters) from provided WWW-Authenticate header value. Rest of the value,
+// which holds other challenges, is returned as well.
+func parseChallenge(s string) (scheme string, params map[string]string, rest string) {
+	s = strings.TrimLeft(s, " \t,")
+	end := strings.IndexAny(s, " \t,")
+	if end < 0 {
+		end = len(s)
+	}
+	params, rest = parseAuthParams(s[end:])
+	return s[:end], params, rest
+}
+
+// parseAuthParams parses comma separated list of key=value parameters, where
+// value can be token or quoted string. Parsing stops at first element that
+// is not parameter, since that is beginning of next challenge, and rest of
+// provided string is returned.
+func parseAuthParams(s string) (map[string]string, string) {
+	params := make(map[string]string)
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		eq := strings.Index(s, "=")
+		if eq <= 0 || strings.ContainsAny(s[:eq], " \t,") {
+			return params, s
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimLeft(s[eq+1:], " \t")
+
+		var value strings.Builder
+		if strings.HasPrefix(s, `"`) {
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				value.WriteByte(s[i])
+			}
+			if i < len(s) {
+				// skip closing quote
+				i++
+			}
+			s = s[i:]
+		} else {
+			end := strings.IndexAny(s, ", \t")
+			if end < 0 {
+				end = len(s)
+			}
+			value.WriteString(s[:end])
+			s = s[end:]
+		}
+		params[key] = value.String()
+	}
+}
+
+// replayableBody makes sure that body of request can be obtained multiple
+// times and returns function that provides fresh copy of it.
+func replayableBody(req *http.Request) (func() (io.ReadCloser, error), error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody != nil {
+		return req.GetBody, nil
+	}
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Body.Close(); err != nil {
+		return nil, err
+	}
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+	req.Body, _ = req.GetBody()
+	return req.GetBody, nil
+}
+
+func randomCnonce() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
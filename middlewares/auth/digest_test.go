@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/delicb/kioto/cliware"
+)
+
+// Example from RFC 7616 section 3.9.1.
+const (
+	rfcUsername = "Mufasa"
+	rfcPassword = "Circle of Life"
+	rfcCnonce   = "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ"
+)
+
+var rfcChallenge = digestChallenge{
+	realm:  "http-auth@example.org",
+	nonce:  "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v",
+	opaque: "FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS",
+	qop:    "auth, auth-int",
+}
+
+func TestDigestAuthorizationRFC7616(t *testing.T) {
+	d := &digestAuth{username: rfcUsername, password: rfcPassword}
+	req, err := http.NewRequest("GET", "http://www.example.org/dir/index.html", nil)
+	require.NoError(t, err)
+
+	for algorithm, response := range map[string]string{
+		"MD5":     "8ca523f5e9506fed4657c9700eebdbec",
+		"SHA-256": "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1",
+	} {
+		challenge := rfcChallenge
+		challenge.algorithm = algorithm
+		authorization, err := d.authorization(&challenge, req, 1, rfcCnonce)
+		require.NoError(t, err)
+		assert.Equal(t, `Digest username="Mufasa", realm="http-auth@example.org", uri="/dir/index.html", `+
+			`algorithm=`+algorithm+`, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", `+
+			`nc=00000001, cnonce="f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ", qop=auth, `+
+			`response="`+response+`", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`,
+			authorization)
+	}
+}
+
+func TestDigestAuthorizationUnsupported(t *testing.T) {
+	d := &digestAuth{username: rfcUsername, password: rfcPassword}
+	req, err := http.NewRequest("GET", "http://www.example.org/", nil)
+	require.NoError(t, err)
+
+	for _, challenge := range []digestChallenge{
+		{nonce: "nonce", algorithm: "SHA-512-256"},
+		{nonce: "nonce", qop: "auth-int"},
+	} {
+		_, err := d.authorization(&challenge, req, 1, rfcCnonce)
+		assert.Error(t, err)
+	}
+}
+
+func TestParseDigestChallenge(t *testing.T) {
+	header := http.Header{}
+	header.Add("WWW-Authenticate", `Basic realm="basic"`)
+	header.Add("WWW-Authenticate", `Digest realm="http-auth@example.org", qop="auth, auth-int", `+
+		`algorithm=SHA-256, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", `+
+		`opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS", stale=TRUE, Basic realm="other"`)
+
+	challenge := parseDigestChallenge(header)
+	require.NotNil(t, challenge)
+	assert.Equal(t, digestChallenge{
+		realm:     "http-auth@example.org",
+		nonce:     "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v",
+		opaque:    "FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS",
+		algorithm: "SHA-256",
+		qop:       "auth, auth-int",
+		stale:     true,
+	}, *challenge)
+
+	assert.Nil(t, parseDigestChallenge(http.Header{"Www-Authenticate": {`Basic realm="basic"`}}))
+
+	// Digest inside parameter value of other scheme is not a challenge
+	challenge = parseDigestChallenge(http.Header{"Www-Authenticate": {
+		`Basic realm="use digest nonce=fake", Digest realm="real", nonce="abc"`,
+	}})
+	require.NotNil(t, challenge)
+	assert.Equal(t, "real", challenge.realm)
+	assert.Equal(t, "abc", challenge.nonce)
+	assert.Nil(t, parseDigestChallenge(http.Header{"Www-Authenticate": {`Basic realm="digest nonce=fake"`}}))
+}
+
+func TestDigestAuthorizationQuoting(t *testing.T) {
+	d := &digestAuth{username: `josé "j" \`, password: "secret"}
+	req, err := http.NewRequest("GET", "http://example.org/", nil)
+	require.NoError(t, err)
+	challenge := digestChallenge{realm: "café", nonce: "abc"}
+	header, err := d.authorization(&challenge, req, 1, "cnonce")
+	require.NoError(t, err)
+	assert.Contains(t, header, `username="josé \"j\" \\"`)
+	assert.Contains(t, header, `realm="café"`)
+}
+
+func TestParseAuthParamsEscapes(t *testing.T) {
+	params, _ := parseAuthParams(`realm="with \"quotes\", and comma", nonce=abc`)
+	assert.Equal(t, `with "quotes", and comma`, params["realm"])
+	assert.Equal(t, "abc", params["nonce"])
+}
+
+func TestDigest(t *testing.T) {
+	var authorizations []string
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Get("Authorization")
+		authorizations = append(authorizations, authorization)
+		data, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(data))
+		if !strings.Contains(authorization, `username="user"`) {
+			w.Header().Set("WWW-Authenticate", `Digest realm="test", qop="auth", algorithm=MD5, nonce="abc", opaque="xyz"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	m := Digest("user", "pass")
+	sender := cliware.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		return http.DefaultClient.Do(req)
+	})
+
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest("POST", server.URL+"/path?q=1", strings.NewReader("payload"))
+		require.NoError(t, err)
+		resp, err := m.Exec(sender).Handle(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		_ = resp.Body.Close()
+	}
+
+	require.Len(t, authorizations, 3, "second request should be authorized in advance")
+	assert.Empty(t, authorizations[0])
+	assert.Contains(t, authorizations[1], `uri="/path?q=1"`)
+	assert.Contains(t, authorizations[1], "nc=00000001")
+	assert.Contains(t, authorizations[2], "nc=00000002")
+	assert.Equal(t, []string{"payload", "payload", "payload"}, bodies)
+}
+
+func TestDigestWrongCredentials(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("WWW-Authenticate", `Digest realm="test", qop="auth", nonce="abc"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	m := Digest("user", "wrong")
+	sender := cliware.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		return http.DefaultClient.Do(req)
+	})
+	req, err := http.NewRequest("GET", server.URL, nil)
+	require.NoError(t, err)
+	resp, err := m.Exec(sender).Handle(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, 2, calls)
+}
+
+func TestDigestPerHost(t *testing.T) {
+	protected := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			w.Header().Set("WWW-Authenticate", `Digest realm="test", qop="auth", nonce="abc"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer protected.Close()
+	var leaked []string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if authorization := r.Header.Get("Authorization"); authorization != "" {
+			leaked = append(leaked, authorization)
+		}
+	}))
+	defer other.Close()
+
+	m := Digest("user", "pass")
+	sender := cliware.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		return http.DefaultClient.Do(req)
+	})
+	for _, u := range []string{protected.URL, other.URL, protected.URL, other.URL} {
+		req, err := http.NewRequest("GET", u, nil)
+		require.NoError(t, err)
+		resp, err := m.Exec(sender).Handle(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		_ = resp.Body.Close()
+	}
+	assert.Empty(t, leaked, "credentials sent to other host")
+}
@@ -0,0 +1,295 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/delicb/kioto"
+	c "github.com/delicb/kioto/cliware"
+	"github.com/delicb/kioto/middlewares/body"
+	"github.com/delicb/kioto/middlewares/headers"
+	kurl "github.com/delicb/kioto/middlewares/url"
+)
+
+// tokenExpiryDelta is how long before actual expiry token is considered
+// expired, to avoid using token that expires while request is in flight.
+const tokenExpiryDelta = 10 * time.Second
+
+// Token holds OAuth2 access token obtained from token endpoint.
+type Token struct {
+	AccessToken  string
+	TokenType    string
+	RefreshToken string
+	// Expiry is time when access token expires. Zero value means that token
+	// does not expire.
+	Expiry time.Time
+}
+
+// Type returns token type to be used in Authorization header. Bearer is
+// returned if token type is not set.
+func (t *Token) Type() string {
+	if t.TokenType == "" || strings.EqualFold(t.TokenType, "bearer") {
+		return "Bearer"
+	}
+	return t.TokenType
+}
+
+// Valid checks if token is set and not about to expire.
+func (t *Token) Valid() bool {
+	if t == nil || t.AccessToken == "" {
+		return false
+	}
+	return t.Expiry.IsZero() || time.Now().Add(tokenExpiryDelta).Before(t.Expiry)
+}
+
+// TokenSource is anything that can provide OAuth2 tokens.
+type TokenSource interface {
+	// Token returns valid token or error if token could not be obtained.
+	Token(ctx context.Context) (*Token, error)
+}
+
+// TokenError is returned when token endpoint rejects token request.
+type TokenError struct {
+	StatusCode  int
+	Code        string
+	Description string
+	Body        []byte
+}
+
+// Error is implementation of error interface for TokenError.
+func (e *TokenError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("oauth2: token request failed with status %d", e.StatusCode)
+	}
+	if e.Description == "" {
+		return fmt.Sprintf("oauth2: token request failed with status %d: %s", e.StatusCode, e.Code)
+	}
+	return fmt.Sprintf("oauth2: token request failed with status %d: %s (%s)", e.StatusCode, e.Code, e.Description)
+}
+
+// OAuth2 sets authorization to request with token obtained from provided
+// token source. If server responds with 401 and token source caches tokens
+// (e.g. one returned by ReuseTokenSource), cached token is dropped, so that
+// next request obtains new one.
+func OAuth2(source TokenSource) c.Middleware {
+	return c.MiddlewareFunc(func(next c.Handler) c.Handler {
+		return c.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+			token, err := source.Token(req.Context())
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Authorization", token.Type()+" "+token.AccessToken)
+			resp, err := next.Handle(req)
+			if err == nil && resp != nil && resp.StatusCode == http.StatusUnauthorized {
+				if cache, ok := source.(tokenInvalidator); ok {
+					cache.invalidate(token)
+				}
+			}
+			return resp, err
+		})
+	})
+}
+
+// tokenInvalidator is implemented by token sources that cache tokens.
+type tokenInvalidator interface {
+	// invalidate drops provided token from cache, if it is still cached.
+	invalidate(token *Token)
+}
+
+// ClientCredentials returns token source that obtains tokens from provided
+// token endpoint using client credentials grant. Token requests are sent
+// with provided client, which should not be client that uses returned
+// token source for authorization. Tokens are cached until shortly before
+// they expire.
+func ClientCredentials(client kioto.Doer, tokenURL, clientID, clientSecret string, scopes ...string) TokenSource {
+	return ReuseTokenSource(nil, &clientCredentialsSource{
+		endpoint: tokenEndpoint{client: client, url: tokenURL, clientID: clientID, clientSecret: clientSecret},
+		scopes:   scopes,
+	})
+}
+
+// RefreshToken returns token source that obtains tokens from provided token
+// endpoint using refresh token grant. If token endpoint issues new refresh
+// token, it is used for subsequent requests. Token requests are sent with
+// provided client, which should not be client that uses returned token source
+// for authorization. Tokens are cached until shortly before they expire.
+func RefreshToken(client kioto.Doer, tokenURL, clientID, clientSecret, refreshToken string) TokenSource {
+	return ReuseTokenSource(nil, &refreshTokenSource{
+		endpoint:     tokenEndpoint{client: client, url: tokenURL, clientID: clientID, clientSecret: clientSecret},
+		refreshToken: refreshToken,
+	})
+}
+
+// ReuseTokenSource returns token source that returns provided token (which
+// can be nil) while it is valid and obtains new one from provided source
+// when needed. It is safe for concurrent use and only one request for new
+// token is made at a time, no matter how many goroutines need token.
+// Goroutines waiting for new token give up when their context is done.
+func ReuseTokenSource(token *Token, source TokenSource) TokenSource {
+	return &reuseTokenSource{
+		token:   token,
+		source:  source,
+		refresh: make(chan struct{}, 1),
+	}
+}
+
+type reuseTokenSource struct {
+	mu     sync.Mutex
+	token  *Token
+	source TokenSource
+	// refresh is semaphore that allows only one token request at a time.
+	// Unlike mutex, waiting for it can be canceled.
+	refresh chan struct{}
+}
+
+func (s *reuseTokenSource) Token(ctx context.Context) (*Token, error) {
+	if token := s.current(); token.Valid() {
+		return token, nil
+	}
+
+	select {
+	case s.refresh <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-s.refresh }()
+
+	// token might have been obtained while waiting
+	if token := s.current(); token.Valid() {
+		return token, nil
+	}
+	token, err := s.source.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.token = token
+	s.mu.Unlock()
+	return token, nil
+}
+
+func (s *reuseTokenSource) current() *Token {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.token
+}
+
+func (s *reuseTokenSource) invalidate(token *Token) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == token {
+		s.token = nil
+	}
+}
+
+type clientCredentialsSource struct {
+	endpoint tokenEndpoint
+	scopes   []string
+}
+
+func (s *clientCredentialsSource) Token(ctx context.Context) (*Token, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(s.scopes) > 0 {
+		form.Set("scope", strings.Join(s.scopes, " "))
+	}
+	return s.endpoint.retrieve(ctx, form)
+}
+
+type refreshTokenSource struct {
+	mu           sync.Mutex
+	endpoint     tokenEndpoint
+	refreshToken string
+}
+
+func (s *refreshTokenSource) Token(ctx context.Context) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, err := s.endpoint.retrieve(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {s.refreshToken},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if token.RefreshToken == "" {
+		token.RefreshToken = s.refreshToken
+	}
+	s.refreshToken = token.RefreshToken
+	return token, nil
+}
+
+// tokenEndpoint holds information needed to send requests to token endpoint.
+type tokenEndpoint struct {
+	client       kioto.Doer
+	url          string
+	clientID     string
+	clientSecret string
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// retrieve sends token request with provided form parameters and parses
+// response. Client authenticates using HTTP Basic scheme, as recommended
+// by RFC 6749 section 2.3.1.
+func (e tokenEndpoint) retrieve(ctx context.Context, form url.Values) (*Token, error) {
+	resp, err := e.client.Do(ctx,
+		headers.Method(http.MethodPost),
+		kurl.URL(e.url),
+		body.String(form.Encode()),
+		headers.Set("Content-Type", "application/x-www-form-urlencoded"),
+		headers.Set("Accept", "application/json"),
+		Basic(url.QueryEscape(e.clientID), url.QueryEscape(e.clientSecret)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	rawData, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed tokenResponse
+	parseErr := json.Unmarshal(rawData, &parsed)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &TokenError{
+			StatusCode:  resp.StatusCode,
+			Code:        parsed.Error,
+			Description: parsed.ErrorDescription,
+			Body:        rawData,
+		}
+	}
+	if parseErr != nil {
+		return nil, fmt.Errorf("oauth2: unable to parse token response: %v", parseErr)
+	}
+	if parsed.AccessToken == "" {
+		return nil, errors.New("oauth2: server response missing access_token")
+	}
+
+	token := &Token{
+		AccessToken:  parsed.AccessToken,
+		TokenType:    parsed.TokenType,
+		RefreshToken: parsed.RefreshToken,
+	}
+	if parsed.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(parsed.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
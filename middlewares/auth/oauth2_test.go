@@ -0,0 +1,217 @@
+package auth_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/delicb/kioto"
+	"github.com/delicb/kioto/cliware"
+	"github.com/delicb/kioto/middlewares/auth"
+)
+
+type tokenServer struct {
+	*httptest.Server
+	requests int32
+	forms    chan map[string]string
+}
+
+func newTokenServer(t *testing.T, handler func(w http.ResponseWriter, r *http.Request)) *tokenServer {
+	ts := &tokenServer{forms: make(chan map[string]string, 100)}
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&ts.requests, 1)
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "client" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error": "invalid_client"}`))
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Error("Unable to parse token request:", err)
+		}
+		form := make(map[string]string)
+		for k := range r.PostForm {
+			form[k] = r.PostForm.Get(k)
+		}
+		ts.forms <- form
+		w.Header().Set("Content-Type", "application/json")
+		handler(w, r)
+	}))
+	return ts
+}
+
+func writeToken(w http.ResponseWriter, token map[string]interface{}) {
+	_ = json.NewEncoder(w).Encode(token)
+}
+
+func TestClientCredentials(t *testing.T) {
+	server := newTokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		writeToken(w, map[string]interface{}{"access_token": "access", "token_type": "bearer", "expires_in": 3600})
+	})
+	defer server.Close()
+
+	source := auth.ClientCredentials(kioto.New(), server.URL, "client", "secret", "read", "write")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := source.Token(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, "access", token.AccessToken)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&server.requests), "token should be fetched only once")
+	form := <-server.forms
+	assert.Equal(t, "client_credentials", form["grant_type"])
+	assert.Equal(t, "read write", form["scope"])
+}
+
+func TestClientCredentialsExpiredToken(t *testing.T) {
+	server := newTokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		// token expiring this soon is never considered valid
+		writeToken(w, map[string]interface{}{"access_token": "access", "expires_in": 1})
+	})
+	defer server.Close()
+
+	source := auth.ClientCredentials(kioto.New(), server.URL, "client", "secret")
+	for i := 0; i < 2; i++ {
+		_, err := source.Token(context.Background())
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&server.requests))
+}
+
+func TestClientCredentialsError(t *testing.T) {
+	server := newTokenServer(t, nil)
+	defer server.Close()
+
+	source := auth.ClientCredentials(kioto.New(), server.URL, "client", "wrong")
+	_, err := source.Token(context.Background())
+	tokenErr, ok := err.(*auth.TokenError)
+	require.True(t, ok, "wrong error type: %T", err)
+	assert.Equal(t, http.StatusUnauthorized, tokenErr.StatusCode)
+	assert.Equal(t, "invalid_client", tokenErr.Code)
+}
+
+func TestRefreshToken(t *testing.T) {
+	issued := int32(0)
+	server := newTokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&issued, 1)
+		token := map[string]interface{}{"access_token": "access", "expires_in": 1}
+		if n == 1 {
+			token["refresh_token"] = "rotated"
+		}
+		writeToken(w, token)
+	})
+	defer server.Close()
+
+	source := auth.RefreshToken(kioto.New(), server.URL, "client", "secret", "initial")
+	for _, expected := range []string{"initial", "rotated", "rotated"} {
+		token, err := source.Token(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, "rotated", token.RefreshToken)
+		form := <-server.forms
+		assert.Equal(t, "refresh_token", form["grant_type"])
+		assert.Equal(t, expected, form["refresh_token"])
+	}
+}
+
+type staticSource struct {
+	token *auth.Token
+}
+
+func (s *staticSource) Token(ctx context.Context) (*auth.Token, error) {
+	return s.token, nil
+}
+
+func TestOAuth2(t *testing.T) {
+	for _, data := range []struct {
+		Token    *auth.Token
+		Expected string
+	}{
+		{Token: &auth.Token{AccessToken: "token"}, Expected: "Bearer token"},
+		{Token: &auth.Token{AccessToken: "token", TokenType: "bearer"}, Expected: "Bearer token"},
+		{Token: &auth.Token{AccessToken: "token", TokenType: "MAC"}, Expected: "MAC token"},
+	} {
+		m := auth.OAuth2(&staticSource{data.Token})
+		req := cliware.EmptyRequest()
+		if _, err := m.Exec(createHandler()).Handle(req); err != nil {
+			t.Error("Unexpected error:", err)
+		}
+		assert.Equal(t, data.Expected, req.Header.Get("Authorization"))
+	}
+}
+
+type blockingSource struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingSource) Token(ctx context.Context) (*auth.Token, error) {
+	close(s.started)
+	<-s.release
+	return &auth.Token{AccessToken: "token"}, nil
+}
+
+func TestReuseTokenSourceWaitCanceled(t *testing.T) {
+	blocking := &blockingSource{started: make(chan struct{}), release: make(chan struct{})}
+	source := auth.ReuseTokenSource(nil, blocking)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		token, err := source.Token(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "token", token.AccessToken)
+	}()
+	<-blocking.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := source.Token(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	close(blocking.release)
+	<-done
+}
+
+func TestOAuth2InvalidatesTokenOn401(t *testing.T) {
+	server := newTokenServer(t, func(w http.ResponseWriter, r *http.Request) {
+		writeToken(w, map[string]interface{}{"access_token": "access", "expires_in": 3600})
+	})
+	defer server.Close()
+
+	var authorizations []string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		if len(authorizations) == 1 {
+			// token revoked
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer api.Close()
+
+	source := auth.ClientCredentials(kioto.New(), server.URL, "client", "secret")
+	client := kioto.New(kioto.Middlewares(auth.OAuth2(source)))
+	for _, expected := range []int{http.StatusUnauthorized, http.StatusOK} {
+		resp, err := client.Request().URL(api.URL).Send()
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, expected, resp.StatusCode)
+	}
+
+	assert.Equal(t, []string{"Bearer access", "Bearer access"}, authorizations)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&server.requests), "token should be fetched again after 401")
+}
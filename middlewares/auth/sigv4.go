@@ -0,0 +1,372 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	c "github.com/delicb/kioto/cliware"
+)
+
+const (
+	sigV4Algorithm     = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat    = "20060102T150405Z"
+	sigV4DateFormat    = "20060102"
+	sigV4Terminator    = "aws4_request"
+	unsignedPayload    = "UNSIGNED-PAYLOAD"
+	emptyPayloadSHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// sigV4IgnoredHeaders are headers that are never signed, since they are
+// commonly changed by proxies and HTTP clients. Trace context and attempt
+// headers are set by tracing and requestid middlewares on every attempt,
+// after request is signed.
+var sigV4IgnoredHeaders = map[string]bool{
+	"authorization":     true,
+	"user-agent":        true,
+	"x-amzn-trace-id":   true,
+	"expect":            true,
+	"traceparent":       true,
+	"tracestate":        true,
+	"x-request-attempt": true,
+}
+
+// Credentials holds AWS access key and (optional) session token.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// CredentialsProvider is anything that can provide AWS credentials.
+type CredentialsProvider interface {
+	// Credentials returns credentials to sign request with.
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+// CredentialsProviderFunc is function variant of CredentialsProvider interface.
+type CredentialsProviderFunc func(ctx context.Context) (Credentials, error)
+
+// Credentials is implementation of CredentialsProvider interface.
+func (f CredentialsProviderFunc) Credentials(ctx context.Context) (Credentials, error) {
+	return f(ctx)
+}
+
+// StaticCredentials returns CredentialsProvider that always returns provided
+// credentials.
+func StaticCredentials(accessKeyID, secretAccessKey, sessionToken string) CredentialsProvider {
+	return CredentialsProviderFunc(func(ctx context.Context) (Credentials, error) {
+		return Credentials{
+			AccessKeyID:     accessKeyID,
+			SecretAccessKey: secretAccessKey,
+			SessionToken:    sessionToken,
+		}, nil
+	})
+}
+
+// Signer signs HTTP requests with AWS Signature Version 4.
+type Signer struct {
+	credentials CredentialsProvider
+	region      string
+	service     string
+	now         func() time.Time
+}
+
+// NewSigner creates new Signer that signs requests for provided region and
+// service (e.g. "s3") with credentials from provided provider.
+func NewSigner(credentials CredentialsProvider, region, service string) *Signer {
+	return &Signer{
+		credentials: credentials,
+		region:      region,
+		service:     service,
+		now:         time.Now,
+	}
+}
+
+// SigV4 signs request with AWS Signature Version 4 and sets Authorization,
+// X-Amz-Date and X-Amz-Content-Sha256 headers. Payload is hashed, except for
+// streaming bodies of unknown length, which are sent as UNSIGNED-PAYLOAD.
+// Payload hash can also be provided by setting X-Amz-Content-Sha256 header
+// before signing. Since signature covers URL, headers and body, this
+// middleware has to be executed after all middlewares that modify request,
+// e.g. by adding it with Client.UsePost. Headers set on every attempt by
+// tracing and requestid middlewares are not signed; custom attempt header
+// name set with requestid.AttemptHeader would be signed and must not be used.
+func SigV4(credentials CredentialsProvider, region, service string) c.Middleware {
+	signer := NewSigner(credentials, region, service)
+	return c.RequestProcessor(signer.Sign)
+}
+
+// SigV4Presign adds AWS Signature Version 4 to request URL query string,
+// so that URL is valid for provided duration without any other
+// authorization. Same ordering rules apply as for SigV4 middleware.
+func SigV4Presign(credentials CredentialsProvider, region, service string, expires time.Duration) c.Middleware {
+	signer := NewSigner(credentials, region, service)
+	return c.RequestProcessor(func(req *http.Request) error {
+		return signer.Presign(req, expires)
+	})
+}
+
+// Sign signs provided request by setting Authorization header.
+func (s *Signer) Sign(req *http.Request) error {
+	creds, err := s.credentials.Credentials(req.Context())
+	if err != nil {
+		return err
+	}
+	now := s.now().UTC()
+
+	req.Header.Del("Authorization")
+	req.Header.Set("X-Amz-Date", now.Format(sigV4TimeFormat))
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+	payload, err := payloadHash(req)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+
+	signedHeaders, canonicalHeaders := s.canonicalHeaders(req)
+	signature := s.signature(creds, now, req, req.URL.Query(), signedHeaders, canonicalHeaders, payload)
+
+	req.Header.Set("Authorization", sigV4Algorithm+
+		" Credential="+creds.AccessKeyID+"/"+s.scope(now)+
+		", SignedHeaders="+signedHeaders+
+		", Signature="+signature)
+	return nil
+}
+
+// Presign signs provided request by adding signature to its URL query string.
+func (s *Signer) Presign(req *http.Request, expires time.Duration) error {
+	creds, err := s.credentials.Credentials(req.Context())
+	if err != nil {
+		return err
+	}
+	now := s.now().UTC()
+
+	payload := unsignedPayload
+	if s.service != "s3" {
+		if payload, err = payloadHash(req); err != nil {
+			return err
+		}
+	}
+
+	signedHeaders, canonicalHeaders := s.canonicalHeaders(req)
+	query := req.URL.Query()
+	query.Del("X-Amz-Signature")
+	query.Set("X-Amz-Algorithm", sigV4Algorithm)
+	query.Set("X-Amz-Credential", creds.AccessKeyID+"/"+s.scope(now))
+	query.Set("X-Amz-Date", now.Format(sigV4TimeFormat))
+	query.Set("X-Amz-Expires", strconv.FormatInt(int64(expires/time.Second), 10))
+	query.Set("X-Amz-SignedHeaders", signedHeaders)
+	if creds.SessionToken != "" {
+		query.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	signature := s.signature(creds, now, req, query, signedHeaders, canonicalHeaders, payload)
+	req.URL.RawQuery = canonicalQuery(query) + "&X-Amz-Signature=" + signature
+	return nil
+}
+
+// signature calculates request signature as described in
+// https://docs.aws.amazon.com/general/latest/gr/sigv4_signing.html
+func (s *Signer) signature(creds Credentials, now time.Time, req *http.Request, query url.Values, signedHeaders, canonicalHeaders, payload string) string {
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s.canonicalURI(req.URL),
+		canonicalQuery(query),
+		canonicalHeaders,
+		signedHeaders,
+		payload,
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		now.Format(sigV4TimeFormat),
+		s.scope(now),
+		hexSHA256([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), now.Format(sigV4DateFormat))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, s.service)
+	key = hmacSHA256(key, sigV4Terminator)
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func (s *Signer) scope(now time.Time) string {
+	return strings.Join([]string{now.Format(sigV4DateFormat), s.region, s.service, sigV4Terminator}, "/")
+}
+
+// canonicalURI returns URI encoded path. Every service except S3 requires
+// path to be normalized and encoded twice.
+func (s *Signer) canonicalURI(u *url.URL) string {
+	p := u.Path
+	if p == "" {
+		p = "/"
+	}
+	if s.service == "s3" {
+		return uriEncode(p, false)
+	}
+	cleaned := path.Clean(p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return uriEncode(uriEncode(cleaned, false), false)
+}
+
+// canonicalHeaders returns list of signed header names and canonical
+// headers block.
+func (s *Signer) canonicalHeaders(req *http.Request) (signed string, canonical string) {
+	values := map[string][]string{
+		"host": {hostWithoutDefaultPort(req)},
+	}
+	for name, vv := range req.Header {
+		name = strings.ToLower(name)
+		if sigV4IgnoredHeaders[name] {
+			continue
+		}
+		values[name] = append(values[name], vv...)
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		trimmed := make([]string, len(values[name]))
+		for i, v := range values[name] {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+		b.WriteString(name)
+		b.WriteString(":")
+		b.WriteString(strings.Join(trimmed, ","))
+		b.WriteString("\n")
+	}
+	return strings.Join(names, ";"), b.String()
+}
+
+// canonicalQuery returns encoded query parameters sorted by key and then by
+// value. Sorting whole "key=value" strings would be wrong when one key is
+// prefix of another ("Param1=b" sorts before "Param=a").
+func canonicalQuery(query url.Values) string {
+	type pair struct{ key, value string }
+	pairs := make([]pair, 0, len(query))
+	for key, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, pair{uriEncode(key, true), uriEncode(value, true)})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].key != pairs[j].key {
+			return pairs[i].key < pairs[j].key
+		}
+		return pairs[i].value < pairs[j].value
+	})
+	encoded := make([]string, len(pairs))
+	for i, p := range pairs {
+		encoded[i] = p.key + "=" + p.value
+	}
+	return strings.Join(encoded, "&")
+}
+
+// payloadHash returns hex encoded SHA256 of request body. Request body is
+// replaced if it had to be read. For bodies of unknown length that can not
+// be read again, UNSIGNED-PAYLOAD is returned.
+func payloadHash(req *http.Request) (string, error) {
+	if hash := req.Header.Get("X-Amz-Content-Sha256"); hash != "" {
+		return hash, nil
+	}
+	if req.Body == nil || req.Body == http.NoBody {
+		return emptyPayloadSHA256, nil
+	}
+
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return "", err
+		}
+		defer body.Close()
+		h := sha256.New()
+		if _, err := io.Copy(h, body); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	if req.ContentLength <= 0 {
+		return unsignedPayload, nil
+	}
+
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return "", err
+	}
+	if err := req.Body.Close(); err != nil {
+		return "", err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(data))
+	return hexSHA256(data), nil
+}
+
+func hostWithoutDefaultPort(req *http.Request) string {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	switch {
+	case req.URL.Scheme == "http" && strings.HasSuffix(host, ":80"):
+		return strings.TrimSuffix(host, ":80")
+	case req.URL.Scheme == "https" && strings.HasSuffix(host, ":443"):
+		return strings.TrimSuffix(host, ":443")
+	}
+	return host
+}
+
+// uriEncode encodes string as required by AWS: every byte except unreserved
+// characters (RFC 3986) is percent encoded. Slash is encoded only if
+// encodeSlash is true.
+func uriEncode(s string, encodeSlash bool) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case 'A' <= ch && ch <= 'Z', 'a' <= ch && ch <= 'z', '0' <= ch && ch <= '9',
+			ch == '-', ch == '_', ch == '.', ch == '~':
+			b.WriteByte(ch)
+		case ch == '/' && !encodeSlash:
+			b.WriteByte(ch)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hexDigits[ch>>4])
+			b.WriteByte(hexDigits[ch&0x0F])
+		}
+	}
+	return b.String()
+}
+
+func hexSHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -14,6 +14,8 @@ import (
 	"io"
 
 	c "github.com/delicb/kioto/cliware"
+	"github.com/delicb/kioto/codec"
+	"github.com/delicb/kioto/form"
 )
 
 // String sets request body to provided string.
@@ -79,6 +81,55 @@ func XML(data interface{}) c.Middleware {
 	})
 }
 
+// Form sets request body to URL-encoded form obtained from provided data.
+// Data can be url.Values, map[string]string, map[string][]string or a struct
+// with optional "form" tags (see form package for details). Content-Type
+// header will be set to application/x-www-form-urlencoded.
+func Form(data interface{}) c.Middleware {
+	return c.RequestProcessor(func(req *http.Request) error {
+		values, err := form.Encode(data)
+		if err != nil {
+			return err
+		}
+		encoded := values.Encode()
+
+		req.Method = getMethod(req)
+		req.Body = ioutil.NopCloser(strings.NewReader(encoded))
+		req.ContentLength = int64(len(encoded))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return nil
+	})
+}
+
+// Encode sets request body to data encoded with codec registered in provided
+// registry for provided content type. If registry is nil, codec.Default is
+// used. If content type is empty, JSON is used. Content-Type header will be
+// set to provided content type.
+func Encode(registry *codec.Registry, contentType string, data interface{}) c.Middleware {
+	return c.RequestProcessor(func(req *http.Request) error {
+		if registry == nil {
+			registry = codec.Default
+		}
+		if contentType == "" {
+			contentType = codec.JSON.ContentType()
+		}
+		enc, err := registry.Lookup(contentType)
+		if err != nil {
+			return err
+		}
+		buff := &bytes.Buffer{}
+		if err := enc.Encode(buff, data); err != nil {
+			return err
+		}
+
+		req.Method = getMethod(req)
+		req.Body = ioutil.NopCloser(buff)
+		req.ContentLength = int64(buff.Len())
+		req.Header.Set("Content-Type", contentType)
+		return nil
+	})
+}
+
 // Reader sets request body to contain content from provided reader.
 // Content type header is not set by this middleware.
 func Reader(body io.Reader) c.Middleware {
@@ -88,15 +139,8 @@ func Reader(body io.Reader) c.Middleware {
 			rc = ioutil.NopCloser(body)
 		}
 
-		if body != nil {
-			switch v := body.(type) {
-			case *bytes.Buffer:
-				req.ContentLength = int64(v.Len())
-			case *bytes.Reader:
-				req.ContentLength = int64(v.Len())
-			case *strings.Reader:
-				req.ContentLength = int64(v.Len())
-			}
+		if l, ok := readerLen(body); ok {
+			req.ContentLength = l
 		}
 		req.Body = rc
 		req.Method = getMethod(req)
@@ -115,6 +159,20 @@ func Provider(provider func() (io.ReadCloser, error)) c.Middleware {
 	})
 }
 
+// readerLen returns number of bytes left in provided reader, for readers
+// whose length is known upfront.
+func readerLen(r io.Reader) (int64, bool) {
+	switch v := r.(type) {
+	case *bytes.Buffer:
+		return int64(v.Len()), true
+	case *bytes.Reader:
+		return int64(v.Len()), true
+	case *strings.Reader:
+		return int64(v.Len()), true
+	}
+	return 0, false
+}
+
 func getMethod(req *http.Request) string {
 	method := req.Method
 	if method == "GET" || method == "" {
@@ -14,7 +14,10 @@ import (
 
 	"strings"
 
+	"net/url"
+
 	"github.com/delicb/kioto/cliware"
+	"github.com/delicb/kioto/codec"
 	"github.com/delicb/kioto/middlewares/body"
 )
 
@@ -102,6 +105,90 @@ func TestJSON(t *testing.T) {
 	}
 }
 
+func TestForm(t *testing.T) {
+	for _, data := range []struct {
+		Data         interface{}
+		ExpectedBody string
+	}{
+		{url.Values{"foo": {"bar", "baz"}}, "foo=bar&foo=baz"},
+		{map[string]string{"foo": "bar baz"}, "foo=bar+baz"},
+		{
+			struct {
+				Foo   string `form:"foo"`
+				Empty string `form:"empty,omitempty"`
+			}{
+				Foo: "bar",
+			}, "foo=bar"},
+	} {
+		req := cliware.EmptyRequest()
+		handler := createHandler()
+		_, err := body.Form(data.Data).Exec(handler).Handle(req)
+		if err != nil {
+			t.Error("Got unexpected error processing request: ", err)
+		}
+		if req.Method != "POST" {
+			t.Error("Wrong request method. Expected: POST, got: ", req.Method)
+		}
+		if req.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+			t.Error("Wrong content-type. Expected application/x-www-form-urlencoded, got: ", req.Header.Get("Content-Type"))
+		}
+		if req.ContentLength != int64(len(data.ExpectedBody)) {
+			t.Errorf("Wrong content length. Expected: %d, got %d.", len(data.ExpectedBody), req.ContentLength)
+		}
+		bodyBytes, _ := ioutil.ReadAll(req.Body)
+		if string(bodyBytes) != data.ExpectedBody {
+			t.Errorf("Wrong body. Expected: \"%s\", got: \"%s\".", data.ExpectedBody, string(bodyBytes))
+		}
+	}
+}
+
+func TestFormError(t *testing.T) {
+	req := cliware.EmptyRequest()
+	handler := createHandler()
+	_, err := body.Form(42).Exec(handler).Handle(req)
+	if err == nil {
+		t.Error("Expected error for unsupported data, got nil.")
+	}
+}
+
+func TestEncode(t *testing.T) {
+	for _, data := range []struct {
+		ContentType         string
+		Data                interface{}
+		ExpectedContentType string
+		ExpectedBody        string
+	}{
+		{"", map[string]string{"foo": "bar"}, "application/json", "{\"foo\":\"bar\"}\n"},
+		{"application/x-www-form-urlencoded", map[string]string{"foo": "bar"}, "application/x-www-form-urlencoded", "foo=bar"},
+		{"text/plain; charset=utf-8", "foo", "text/plain; charset=utf-8", "foo"},
+	} {
+		req := cliware.EmptyRequest()
+		handler := createHandler()
+		_, err := body.Encode(nil, data.ContentType, data.Data).Exec(handler).Handle(req)
+		if err != nil {
+			t.Error("Got unexpected error processing request: ", err)
+		}
+		if req.Header.Get("Content-Type") != data.ExpectedContentType {
+			t.Errorf("Wrong content-type. Expected %s, got: %s", data.ExpectedContentType, req.Header.Get("Content-Type"))
+		}
+		if req.ContentLength != int64(len(data.ExpectedBody)) {
+			t.Errorf("Wrong content length. Expected: %d, got %d.", len(data.ExpectedBody), req.ContentLength)
+		}
+		bodyBytes, _ := ioutil.ReadAll(req.Body)
+		if string(bodyBytes) != data.ExpectedBody {
+			t.Errorf("Wrong body. Expected: \"%s\", got: \"%s\".", data.ExpectedBody, string(bodyBytes))
+		}
+	}
+}
+
+func TestEncodeUnsupported(t *testing.T) {
+	req := cliware.EmptyRequest()
+	_, err := body.Encode(codec.NewRegistry(), "application/json", "foo").Exec(createHandler()).Handle(req)
+	if _, ok := err.(*codec.UnsupportedContentTypeError); !ok {
+		t.Errorf("Expected UnsupportedContentTypeError, got: %v", err)
+	}
+}
+
 func TestXML(t *testing.T) {
 	type person struct {
 		Name    string
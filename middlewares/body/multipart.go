@@ -0,0 +1,253 @@
+package body
+
+import (
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	c "github.com/delicb/kioto/cliware"
+)
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// Multipart is builder for multipart/form-data request body. It combines
+// form fields, files from disk and arbitrary readers. Body is encoded while
+// it is being sent (through io.Pipe), so large uploads are not buffered in
+// memory. Encoding starts on first read of the body, so nothing is opened if
+// request is never sent. If sizes of all parts are known, request ContentLength is set,
+// otherwise request is sent with chunked encoding.
+//
+// Body built only from fields and files can be encoded again, so retries
+// encode it anew. Body with reader parts can not, so if request method is
+// configured to be retried, retry middleware caches it in memory.
+//
+// Multipart implements cliware.Middleware, so it can be used directly:
+//
+//	client.Request().Post().Use(body.NewMultipart().Field("name", "value").File("file", "/tmp/data.csv"))
+type Multipart struct {
+	parts []*multipartPart
+}
+
+type multipartPart struct {
+	header textproto.MIMEHeader
+	// path is set for parts whose content is file on disk
+	path string
+	// reader is set for parts whose content is provided reader
+	reader io.Reader
+	value  string
+}
+
+// NewMultipart creates new empty multipart body builder.
+func NewMultipart() *Multipart {
+	return &Multipart{}
+}
+
+// Field adds form field with provided name and value.
+func (m *Multipart) Field(name, value string) *Multipart {
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", `form-data; name="`+quoteEscaper.Replace(name)+`"`)
+	m.parts = append(m.parts, &multipartPart{header: header, value: value})
+	return m
+}
+
+// File adds content of file with provided path as form field with provided
+// name. Content type of part is guessed from file extension. File is opened
+// only when body is being sent.
+func (m *Multipart) File(fieldName, path string) *Multipart {
+	header := fileHeader(fieldName, filepath.Base(path))
+	if contentType := mime.TypeByExtension(filepath.Ext(path)); contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	m.parts = append(m.parts, &multipartPart{header: header, path: path})
+	return m
+}
+
+// Reader adds content of provided reader as file form field with provided
+// name and file name. If reader is io.ReadCloser, it is closed after its
+// content is sent. Since reader can be read only once, request with such
+// body can not be sent again (e.g. on redirect).
+func (m *Multipart) Reader(fieldName, fileName string, r io.Reader) *Multipart {
+	m.parts = append(m.parts, &multipartPart{header: fileHeader(fieldName, fileName), reader: r})
+	return m
+}
+
+// Part adds part with arbitrary headers and content from provided reader.
+// Same rules as for Reader method apply to provided reader.
+func (m *Multipart) Part(header textproto.MIMEHeader, r io.Reader) *Multipart {
+	m.parts = append(m.parts, &multipartPart{header: header, reader: r})
+	return m
+}
+
+// Exec is implementation of cliware.Middleware interface.
+func (m *Multipart) Exec(next c.Handler) c.Handler {
+	return c.RequestProcessor(m.apply).Exec(next)
+}
+
+func (m *Multipart) apply(req *http.Request) error {
+	size, replayable, err := m.size()
+	if err != nil {
+		return err
+	}
+	boundary := multipart.NewWriter(ioutil.Discard).Boundary()
+
+	req.Method = getMethod(req)
+	req.Header.Set("Content-Type", "multipart/form-data; boundary="+boundary)
+	req.Body = &multipartBody{m: m, boundary: boundary}
+	req.ContentLength = size
+	req.GetBody = nil
+	if replayable {
+		req.GetBody = func() (io.ReadCloser, error) {
+			return &multipartBody{m: m, boundary: boundary}, nil
+		}
+	}
+	return nil
+}
+
+// size calculates total size of encoded body or returns -1 if size of any
+// of the parts is not known. It also reports if body can be encoded more
+// than once, which is not the case if any part uses reader.
+func (m *Multipart) size() (size int64, replayable bool, err error) {
+	counter := &countingWriter{}
+	w := multipart.NewWriter(counter)
+	known, replayable := true, true
+	var contentSize int64
+	for _, part := range m.parts {
+		if _, err := w.CreatePart(part.header); err != nil {
+			return 0, false, err
+		}
+		switch {
+		case part.path != "":
+			info, err := os.Stat(part.path)
+			if err != nil {
+				return 0, false, err
+			}
+			contentSize += info.Size()
+		case part.reader != nil:
+			replayable = false
+			if l, ok := readerLen(part.reader); ok {
+				contentSize += l
+			} else {
+				known = false
+			}
+		default:
+			contentSize += int64(len(part.value))
+		}
+	}
+	if err := w.Close(); err != nil {
+		return 0, false, err
+	}
+	if !known {
+		return -1, replayable, nil
+	}
+	return counter.n + contentSize, replayable, nil
+}
+
+// multipartBody is request body that starts encoding on first read. Closing
+// it before first read does nothing, while closing it afterwards stops
+// encoding goroutine and releases files it opened.
+type multipartBody struct {
+	m        *Multipart
+	boundary string
+
+	mu     sync.Mutex
+	pr     *io.PipeReader
+	closed bool
+}
+
+// Read is implementation of io.Reader interface.
+func (b *multipartBody) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return 0, io.ErrClosedPipe
+	}
+	if b.pr == nil {
+		b.pr = b.m.stream(b.boundary)
+	}
+	pr := b.pr
+	b.mu.Unlock()
+	return pr.Read(p)
+}
+
+// Close is implementation of io.Closer interface.
+func (b *multipartBody) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	pr := b.pr
+	b.mu.Unlock()
+	if pr == nil {
+		return nil
+	}
+	return pr.Close()
+}
+
+// stream starts encoding of body in separate goroutine and returns reader
+// from which encoded body can be read.
+func (m *Multipart) stream(boundary string) *io.PipeReader {
+	pr, pw := io.Pipe()
+	go func() {
+		w := multipart.NewWriter(pw)
+		if err := w.SetBoundary(boundary); err != nil {
+			_ = pw.CloseWithError(err)
+			return
+		}
+		for _, part := range m.parts {
+			if err := writePart(w, part); err != nil {
+				_ = pw.CloseWithError(err)
+				return
+			}
+		}
+		_ = pw.CloseWithError(w.Close())
+	}()
+	return pr
+}
+
+func writePart(w *multipart.Writer, part *multipartPart) error {
+	pw, err := w.CreatePart(part.header)
+	if err != nil {
+		return err
+	}
+	var content io.Reader
+	switch {
+	case part.path != "":
+		f, err := os.Open(part.path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		content = f
+	case part.reader != nil:
+		if closer, ok := part.reader.(io.Closer); ok {
+			defer closer.Close()
+		}
+		content = part.reader
+	default:
+		content = strings.NewReader(part.value)
+	}
+	_, err = io.Copy(pw, content)
+	return err
+}
+
+func fileHeader(fieldName, fileName string) textproto.MIMEHeader {
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", `form-data; name="`+quoteEscaper.Replace(fieldName)+
+		`"; filename="`+quoteEscaper.Replace(fileName)+`"`)
+	header.Set("Content-Type", "application/octet-stream")
+	return header
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,252 @@
+package body_test
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/delicb/kioto"
+	"github.com/delicb/kioto/cliware"
+	"github.com/delicb/kioto/middlewares/body"
+)
+
+type part struct {
+	FormName    string
+	FileName    string
+	ContentType string
+	Header      string
+	Content     string
+}
+
+func readMultipart(t *testing.T, req *http.Request, r io.Reader) ([]part, int64) {
+	mediaType, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/form-data", mediaType)
+
+	counter := &countingReader{r: r}
+	reader := multipart.NewReader(counter, params["boundary"])
+	var parts []part
+	for {
+		p, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		content, err := ioutil.ReadAll(p)
+		require.NoError(t, err)
+		parts = append(parts, part{
+			FormName:    p.FormName(),
+			FileName:    p.FileName(),
+			ContentType: p.Header.Get("Content-Type"),
+			Header:      p.Header.Get("X-Custom"),
+			Content:     string(content),
+		})
+	}
+	_, _ = io.Copy(ioutil.Discard, counter)
+	return parts, counter.n
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func TestMultipart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kioto-multipart")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "data.json")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"a": 1}`), 0600))
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", `form-data; name="custom"`)
+	header.Set("X-Custom", "value")
+
+	m := body.NewMultipart().
+		Field("name", "kioto").
+		File("file", path).
+		Reader("upload", `report "final".txt`, strings.NewReader("report content")).
+		Part(header, strings.NewReader("custom content"))
+
+	req := cliware.EmptyRequest()
+	_, err = m.Exec(createHandler()).Handle(req)
+	require.NoError(t, err)
+
+	assert.Equal(t, "POST", req.Method)
+	assert.Nil(t, req.GetBody, "body with reader parts should not be replayable")
+	parts, size := readMultipart(t, req, req.Body)
+	assert.Equal(t, req.ContentLength, size, "content length does not match body size")
+	assert.Equal(t, []part{
+		{FormName: "name", Content: "kioto"},
+		{FormName: "file", FileName: "data.json", ContentType: "application/json", Content: `{"a": 1}`},
+		{FormName: "upload", FileName: `report "final".txt`, ContentType: "application/octet-stream", Content: "report content"},
+		{FormName: "custom", Header: "value", Content: "custom content"},
+	}, parts)
+}
+
+func TestMultipartUnknownSize(t *testing.T) {
+	pr, pw := io.Pipe()
+	go func() {
+		_, _ = pw.Write([]byte("streamed"))
+		_ = pw.Close()
+	}()
+	m := body.NewMultipart().Reader("stream", "stream.bin", pr)
+
+	req := cliware.EmptyRequest()
+	_, err := m.Exec(createHandler()).Handle(req)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), req.ContentLength)
+
+	parts, _ := readMultipart(t, req, req.Body)
+	require.Len(t, parts, 1)
+	assert.Equal(t, "streamed", parts[0].Content)
+}
+
+func TestMultipartReplayable(t *testing.T) {
+	m := body.NewMultipart().Field("first", "1").Field("second", "2")
+	req := cliware.EmptyRequest()
+	req.Method = "PUT"
+	_, err := m.Exec(createHandler()).Handle(req)
+	require.NoError(t, err)
+	assert.Equal(t, "PUT", req.Method)
+	require.NotNil(t, req.GetBody)
+
+	first, _ := readMultipart(t, req, req.Body)
+	again, err := req.GetBody()
+	require.NoError(t, err)
+	second, _ := readMultipart(t, req, again)
+	assert.Equal(t, first, second)
+}
+
+func TestMultipartMissingFile(t *testing.T) {
+	m := body.NewMultipart().File("file", "/does/not/exist")
+	req := cliware.EmptyRequest()
+	_, err := m.Exec(createHandler()).Handle(req)
+	assert.Error(t, err)
+}
+
+type trackingReader struct {
+	mu    sync.Mutex
+	reads int
+}
+
+func (r *trackingReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reads++
+	return 0, io.EOF
+}
+
+func (r *trackingReader) Reads() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.reads
+}
+
+func TestMultipartLazy(t *testing.T) {
+	content := &trackingReader{}
+	m := body.NewMultipart().Field("name", "value").Reader("file", "file.bin", content)
+
+	req := cliware.EmptyRequest()
+	_, err := m.Exec(createHandler()).Handle(req)
+	require.NoError(t, err)
+
+	// encoding must not start until body is read
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, 0, content.Reads())
+	assert.NoError(t, req.Body.Close(), "close before read")
+	_, err = req.Body.Read(make([]byte, 1))
+	assert.Error(t, err, "read after close")
+	assert.Equal(t, 0, content.Reads())
+
+	req = cliware.EmptyRequest()
+	_, err = m.Exec(createHandler()).Handle(req)
+	require.NoError(t, err)
+	parts, _ := readMultipart(t, req, req.Body)
+	require.Len(t, parts, 2)
+	assert.Equal(t, 1, content.Reads())
+	assert.NoError(t, req.Body.Close())
+}
+
+func TestMultipartCloseStopsEncoding(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kioto-multipart")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "large.bin")
+	require.NoError(t, ioutil.WriteFile(path, make([]byte, 1<<20), 0600))
+
+	req := cliware.EmptyRequest()
+	_, err = body.NewMultipart().File("file", path).Exec(createHandler()).Handle(req)
+	require.NoError(t, err)
+
+	_, err = req.Body.Read(make([]byte, 10))
+	require.NoError(t, err)
+	require.NoError(t, req.Body.Close())
+	_, err = req.Body.Read(make([]byte, 10))
+	assert.Error(t, err)
+}
+
+// gateReader produces size bytes, but blocks after first half until gate is
+// closed. Half of content can be read only if server receives request before
+// whole body is read.
+type gateReader struct {
+	size, read int
+	gate       chan struct{}
+}
+
+func (r *gateReader) Read(p []byte) (int, error) {
+	if r.read >= r.size {
+		return 0, io.EOF
+	}
+	if r.read >= r.size/2 {
+		select {
+		case <-r.gate:
+		case <-time.After(5 * time.Second):
+			return 0, errors.New("body buffered before request was sent")
+		}
+	}
+	n := len(p)
+	if n > r.size-r.read {
+		n = r.size - r.read
+	}
+	r.read += n
+	return n, nil
+}
+
+func TestMultipartStreamedWithClient(t *testing.T) {
+	content := &gateReader{size: 4 << 20, gate: make(chan struct{})}
+	var received int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(content.gate)
+		received, _ = io.Copy(ioutil.Discard, r.Body)
+	}))
+	defer server.Close()
+
+	resp, err := kioto.New().Request().Post().URL(server.URL).Use(
+		body.NewMultipart().Reader("file", "file.bin", content),
+	).Send()
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, received > int64(content.size), "whole body received")
+}
@@ -0,0 +1,287 @@
+// Package cache contains middleware that caches HTTP responses according to
+// RFC 7234, with pluggable storage for cached entries.
+package cache
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	c "github.com/delicb/kioto/cliware"
+)
+
+// StatusHeader is name of header that is set on responses served from cache.
+// Its value is one of StatusHit, StatusRevalidated or StatusStale.
+const StatusHeader = "X-Kioto-Cache"
+
+const (
+	// StatusHit means that response was fresh and served from cache without
+	// contacting origin server.
+	StatusHit = "hit"
+	// StatusRevalidated means that stale response was confirmed by origin
+	// server as still valid (304 Not Modified).
+	StatusRevalidated = "revalidated"
+	// StatusStale means that stale response was served because origin server
+	// failed (stale-if-error).
+	StatusStale = "stale"
+)
+
+var defaultMaxBodySize int64 = 10 << 20
+
+// cacheableStatus contains status codes that are cacheable by default, as
+// defined in RFC 7231 section 6.1.
+var cacheableStatus = map[int]bool{
+	200: true, 203: true, 204: true, 300: true, 301: true,
+	404: true, 405: true, 410: true, 414: true, 501: true,
+}
+
+// Option is function that configures Cache.
+type Option func(cache *Cache)
+
+// StaleIfError sets for how long after expiration cached response can be
+// served if origin server fails (returns error or status code 500 or higher).
+// Value of stale-if-error Cache-Control directive has precedence over this
+// value. By default, stale responses are not served unless directive is set.
+// Responses with must-revalidate, proxy-revalidate or no-cache directives are
+// never served stale.
+func StaleIfError(duration time.Duration) Option {
+	return func(cache *Cache) {
+		cache.staleIfError = duration
+	}
+}
+
+// MaxBodySize sets size of largest response body that will be cached.
+// Larger responses are passed through without caching. Default is 10MB.
+func MaxBodySize(size int64) Option {
+	return func(cache *Cache) {
+		cache.maxBodySize = size
+	}
+}
+
+// Cache is cliware.Middleware that serves responses from provided Store when
+// possible and stores cacheable responses into it. Stale responses are
+// revalidated with If-None-Match and If-Modified-Since headers.
+// Only GET and HEAD requests are cached, while successful unsafe requests
+// invalidate entries for their URL.
+//
+// Entries are keyed by request URL, which is set by request specific
+// middlewares, so Cache has to be added to client with Client.UsePost (or
+// kioto.PostMiddlewares option). Requests without URL host bypass the cache.
+type Cache struct {
+	store        Store
+	staleIfError time.Duration
+	maxBodySize  int64
+	now          func() time.Time
+}
+
+// New creates new Cache middleware that uses provided store.
+func New(store Store, options ...Option) *Cache {
+	cache := &Cache{
+		store:       store,
+		maxBodySize: defaultMaxBodySize,
+		now:         time.Now,
+	}
+	for _, opt := range options {
+		opt(cache)
+	}
+	return cache
+}
+
+// Exec is implementation of cliware.Middleware interface.
+func (cache *Cache) Exec(next c.Handler) c.Handler {
+	return c.HandlerFunc(func(req *http.Request) (resp *http.Response, err error) {
+		// without host, URL is not set yet and key would be shared by
+		// unrelated requests
+		if req.URL == nil || req.URL.Host == "" {
+			return next.Handle(req)
+		}
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			return cache.invalidate(next, req)
+		}
+
+		reqCC := parseCacheControl(req.Header)
+		if reqCC.has("no-store") || isConditional(req) {
+			return next.Handle(req)
+		}
+
+		key := cacheKey(req)
+		entry, ok, err := cache.store.Get(key)
+		if err != nil || (ok && !varyMatches(entry, req)) {
+			ok = false
+		}
+
+		if ok && entry.fresh(reqCC, cache.now()) {
+			return entry.response(req, cache.now(), StatusHit), nil
+		}
+
+		outReq := req
+		if ok && entry.hasValidators() {
+			outReq = conditionalRequest(req, entry)
+		}
+
+		requestTime := cache.now()
+		resp, err = next.Handle(outReq)
+		responseTime := cache.now()
+
+		if ok && (err != nil || resp.StatusCode >= 500) && entry.staleAllowedOnError(reqCC, cache.staleIfError, responseTime) {
+			discard(resp)
+			return entry.response(req, responseTime, StatusStale), nil
+		}
+		if err != nil {
+			return resp, err
+		}
+
+		if ok && resp.StatusCode == http.StatusNotModified && outReq != req {
+			updated := entry.clone()
+			updateHeaders(updated.Header, resp.Header)
+			updated.RequestTime = requestTime
+			updated.ResponseTime = responseTime
+			_ = cache.store.Set(key, updated)
+			discard(resp)
+			return updated.response(req, responseTime, StatusRevalidated), nil
+		}
+
+		cache.storeResponse(key, req, reqCC, resp, requestTime, responseTime)
+		return resp, nil
+	})
+}
+
+// invalidate sends unsafe request and, if it succeeds, removes cached entries
+// for its URL, as required by RFC 7234 section 4.4.
+func (cache *Cache) invalidate(next c.Handler, req *http.Request) (*http.Response, error) {
+	resp, err := next.Handle(req)
+	if err == nil && resp.StatusCode < 400 {
+		for _, method := range []string{http.MethodGet, http.MethodHead} {
+			cachedReq := *req
+			cachedReq.Method = method
+			_ = cache.store.Delete(cacheKey(&cachedReq))
+		}
+	}
+	return resp, err
+}
+
+// storeResponse stores response if it is cacheable. Response body is read
+// and replaced with in-memory copy.
+func (cache *Cache) storeResponse(key string, req *http.Request, reqCC cacheControl, resp *http.Response, requestTime, responseTime time.Time) {
+	respCC := parseCacheControl(resp.Header)
+	if !cacheableStatus[resp.StatusCode] || respCC.has("no-store") || reqCC.has("no-store") {
+		return
+	}
+	if resp.Header.Get("Vary") == "*" {
+		return
+	}
+	if resp.ContentLength > cache.maxBodySize {
+		return
+	}
+
+	entry := &Entry{
+		StatusCode:   resp.StatusCode,
+		Status:       resp.Status,
+		Header:       resp.Header.Clone(),
+		RequestTime:  requestTime,
+		ResponseTime: responseTime,
+		Vary:         varyValues(resp.Header, req.Header),
+	}
+	// responses that are never fresh, can not be revalidated and can not be
+	// served when origin fails would never be used, so do not store them
+	if entry.freshnessLifetime() <= 0 && !entry.hasValidators() && !entry.staleAllowedOnError(reqCC, cache.staleIfError, responseTime) {
+		return
+	}
+
+	if resp.Body != nil {
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, cache.maxBodySize+1))
+		rest := resp.Body
+		if err != nil || int64(len(body)) > cache.maxBodySize {
+			// give caller everything that was read so far together with the rest
+			resp.Body = readCloser{io.MultiReader(bytes.NewReader(body), rest), rest}
+			return
+		}
+		_ = rest.Close()
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		entry.Body = body
+	}
+	_ = cache.store.Set(key, entry)
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func cacheKey(req *http.Request) string {
+	return req.Method + " " + req.URL.String()
+}
+
+func isConditional(req *http.Request) bool {
+	for _, h := range []string{"If-None-Match", "If-Modified-Since", "If-Match", "If-Unmodified-Since", "If-Range", "Range"} {
+		if req.Header.Get(h) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// conditionalRequest creates copy of request with validators from entry.
+func conditionalRequest(req *http.Request, entry *Entry) *http.Request {
+	condReq := req.Clone(req.Context())
+	if etag := entry.Header.Get("ETag"); etag != "" {
+		condReq.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := entry.Header.Get("Last-Modified"); lastModified != "" {
+		condReq.Header.Set("If-Modified-Since", lastModified)
+	}
+	return condReq
+}
+
+// varyValues returns values of request headers listed in Vary response header.
+func varyValues(respHeader, reqHeader http.Header) http.Header {
+	var vary http.Header
+	for _, line := range respHeader.Values("Vary") {
+		for _, name := range strings.Split(line, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			if vary == nil {
+				vary = make(http.Header)
+			}
+			vary[name] = reqHeader.Values(name)
+		}
+	}
+	return vary
+}
+
+// varyMatches checks if request headers listed in Vary of cached response
+// have same values as when response was stored.
+func varyMatches(entry *Entry, req *http.Request) bool {
+	for name, values := range entry.Vary {
+		if strings.Join(values, ", ") != strings.Join(req.Header.Values(name), ", ") {
+			return false
+		}
+	}
+	return true
+}
+
+// updateHeaders replaces headers of cached response with ones from 304
+// response, as defined in RFC 7234 section 4.3.4.
+func updateHeaders(cached, fresh http.Header) {
+	for name, values := range fresh {
+		switch name {
+		case "Content-Length", "Content-Encoding", "Transfer-Encoding":
+			continue
+		}
+		cached[name] = values
+	}
+}
+
+// discard releases resources held by response that will not be returned.
+func discard(resp *http.Response) {
+	if resp == nil || resp.Body == nil {
+		return
+	}
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+	_ = resp.Body.Close()
+}
@@ -0,0 +1,297 @@
+package cache_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/delicb/kioto"
+	"github.com/delicb/kioto/cliware"
+	"github.com/delicb/kioto/middlewares/cache"
+)
+
+type origin struct {
+	requests []*http.Request
+	handle   func(req *http.Request) (*http.Response, error)
+}
+
+func (o *origin) Handle(req *http.Request) (*http.Response, error) {
+	o.requests = append(o.requests, req)
+	return o.handle(req)
+}
+
+func response(status int, body string, header ...string) *http.Response {
+	h := make(http.Header)
+	for i := 0; i+1 < len(header); i += 2 {
+		h.Add(header[i], header[i+1])
+	}
+	return &http.Response{
+		StatusCode:    status,
+		Status:        http.StatusText(status),
+		Header:        h,
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+}
+
+func request(method string) *http.Request {
+	req := cliware.EmptyRequest()
+	req.Method = method
+	req.URL = &url.URL{Scheme: "https", Host: "delic.rs", Path: "/resource"}
+	return req
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	data, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestCacheFreshHit(t *testing.T) {
+	o := &origin{handle: func(req *http.Request) (*http.Response, error) {
+		return response(200, "content", "Cache-Control", "max-age=60"), nil
+	}}
+	h := cache.New(cache.NewMemoryStore(10)).Exec(o)
+
+	resp, err := h.Handle(request("GET"))
+	require.NoError(t, err)
+	assert.Equal(t, "content", readBody(t, resp))
+	assert.Empty(t, resp.Header.Get(cache.StatusHeader))
+
+	resp, err = h.Handle(request("GET"))
+	require.NoError(t, err)
+	assert.Equal(t, "content", readBody(t, resp))
+	assert.Equal(t, cache.StatusHit, resp.Header.Get(cache.StatusHeader))
+	assert.Len(t, o.requests, 1, "second request should be served from cache")
+}
+
+func TestCacheNotCacheable(t *testing.T) {
+	for _, header := range [][]string{
+		{"Cache-Control", "no-store, max-age=60"},
+		{"Cache-Control", "max-age=60", "Vary", "*"},
+		{},
+	} {
+		o := &origin{handle: func(req *http.Request) (*http.Response, error) {
+			return response(200, "content", header...), nil
+		}}
+		h := cache.New(cache.NewMemoryStore(10)).Exec(o)
+		for i := 0; i < 2; i++ {
+			_, err := h.Handle(request("GET"))
+			require.NoError(t, err)
+		}
+		assert.Len(t, o.requests, 2, "response with headers %v should not be cached", header)
+	}
+}
+
+func TestCacheRequestNoStore(t *testing.T) {
+	o := &origin{handle: func(req *http.Request) (*http.Response, error) {
+		return response(200, "content", "Cache-Control", "max-age=60"), nil
+	}}
+	h := cache.New(cache.NewMemoryStore(10)).Exec(o)
+	for i := 0; i < 2; i++ {
+		req := request("GET")
+		req.Header.Set("Cache-Control", "no-store")
+		_, err := h.Handle(req)
+		require.NoError(t, err)
+	}
+	assert.Len(t, o.requests, 2)
+}
+
+func TestCacheRevalidation(t *testing.T) {
+	o := &origin{handle: func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("If-None-Match") == `"v1"` {
+			return response(304, "", "Cache-Control", "max-age=60", "X-Revalidated", "yes"), nil
+		}
+		return response(200, "content", "Cache-Control", "max-age=0", "ETag", `"v1"`), nil
+	}}
+	h := cache.New(cache.NewMemoryStore(10)).Exec(o)
+
+	_, err := h.Handle(request("GET"))
+	require.NoError(t, err)
+
+	resp, err := h.Handle(request("GET"))
+	require.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "content", readBody(t, resp))
+	assert.Equal(t, cache.StatusRevalidated, resp.Header.Get(cache.StatusHeader))
+	assert.Equal(t, "yes", resp.Header.Get("X-Revalidated"))
+	require.Len(t, o.requests, 2)
+	assert.Equal(t, `"v1"`, o.requests[1].Header.Get("If-None-Match"))
+
+	// headers from 304 made entry fresh again
+	resp, err = h.Handle(request("GET"))
+	require.NoError(t, err)
+	assert.Equal(t, cache.StatusHit, resp.Header.Get(cache.StatusHeader))
+	assert.Len(t, o.requests, 2)
+}
+
+func TestCacheLastModifiedRevalidation(t *testing.T) {
+	lastModified := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	o := &origin{handle: func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("If-Modified-Since") == lastModified {
+			return response(304, ""), nil
+		}
+		return response(200, "content", "Cache-Control", "no-cache", "Last-Modified", lastModified), nil
+	}}
+	h := cache.New(cache.NewMemoryStore(10)).Exec(o)
+
+	_, err := h.Handle(request("GET"))
+	require.NoError(t, err)
+	resp, err := h.Handle(request("GET"))
+	require.NoError(t, err)
+	assert.Equal(t, cache.StatusRevalidated, resp.Header.Get(cache.StatusHeader))
+	assert.Equal(t, "content", readBody(t, resp))
+}
+
+func TestCacheStaleIfError(t *testing.T) {
+	failing := false
+	o := &origin{handle: func(req *http.Request) (*http.Response, error) {
+		if failing {
+			return nil, errors.New("connection refused")
+		}
+		return response(200, "content", "Cache-Control", "max-age=0, stale-if-error=60"), nil
+	}}
+	h := cache.New(cache.NewMemoryStore(10)).Exec(o)
+
+	_, err := h.Handle(request("GET"))
+	require.NoError(t, err)
+
+	failing = true
+	resp, err := h.Handle(request("GET"))
+	require.NoError(t, err)
+	assert.Equal(t, cache.StatusStale, resp.Header.Get(cache.StatusHeader))
+	assert.Equal(t, "content", readBody(t, resp))
+}
+
+func TestCacheStaleIfErrorOption(t *testing.T) {
+	status := 200
+	o := &origin{handle: func(req *http.Request) (*http.Response, error) {
+		return response(status, "content", "Cache-Control", "max-age=0"), nil
+	}}
+
+	for _, data := range []struct {
+		Options  []cache.Option
+		Expected int
+	}{
+		{Options: nil, Expected: 503},
+		{Options: []cache.Option{cache.StaleIfError(time.Minute)}, Expected: 200},
+	} {
+		status = 200
+		h := cache.New(cache.NewMemoryStore(10), data.Options...).Exec(o)
+		_, err := h.Handle(request("GET"))
+		require.NoError(t, err)
+
+		status = 503
+		resp, err := h.Handle(request("GET"))
+		require.NoError(t, err)
+		assert.Equal(t, data.Expected, resp.StatusCode)
+	}
+}
+
+func TestCacheStaleIfErrorRevalidate(t *testing.T) {
+	for _, directive := range []string{"must-revalidate", "proxy-revalidate", "no-cache"} {
+		failing := false
+		o := &origin{handle: func(req *http.Request) (*http.Response, error) {
+			if failing {
+				return nil, errors.New("connection refused")
+			}
+			return response(200, "content", "Cache-Control", "max-age=0, stale-if-error=60, "+directive), nil
+		}}
+		h := cache.New(cache.NewMemoryStore(10), cache.StaleIfError(time.Minute)).Exec(o)
+
+		_, err := h.Handle(request("GET"))
+		require.NoError(t, err, directive)
+
+		failing = true
+		_, err = h.Handle(request("GET"))
+		assert.Error(t, err, directive)
+	}
+}
+
+func TestCacheVary(t *testing.T) {
+	o := &origin{handle: func(req *http.Request) (*http.Response, error) {
+		return response(200, req.Header.Get("Accept"), "Cache-Control", "max-age=60", "Vary", "Accept"), nil
+	}}
+	h := cache.New(cache.NewMemoryStore(10)).Exec(o)
+
+	for _, accept := range []string{"application/json", "application/json", "text/plain"} {
+		req := request("GET")
+		req.Header.Set("Accept", accept)
+		resp, err := h.Handle(req)
+		require.NoError(t, err)
+		assert.Equal(t, accept, readBody(t, resp))
+	}
+	assert.Len(t, o.requests, 2, "only request with same Accept header should be served from cache")
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	o := &origin{handle: func(req *http.Request) (*http.Response, error) {
+		return response(200, "content", "Cache-Control", "max-age=60"), nil
+	}}
+	store := cache.NewMemoryStore(10)
+	h := cache.New(store).Exec(o)
+
+	for _, method := range []string{"GET", "HEAD"} {
+		_, err := h.Handle(request(method))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, store.Len())
+
+	_, err := h.Handle(request("DELETE"))
+	require.NoError(t, err)
+	assert.Equal(t, 0, store.Len())
+}
+
+func TestCacheMaxBodySize(t *testing.T) {
+	o := &origin{handle: func(req *http.Request) (*http.Response, error) {
+		resp := response(200, "large content", "Cache-Control", "max-age=60")
+		resp.ContentLength = -1
+		return resp, nil
+	}}
+	store := cache.NewMemoryStore(10)
+	h := cache.New(store, cache.MaxBodySize(5)).Exec(o)
+
+	resp, err := h.Handle(request("GET"))
+	require.NoError(t, err)
+	assert.Equal(t, "large content", readBody(t, resp))
+	assert.Equal(t, 0, store.Len())
+}
+
+func TestCacheWithClient(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "max-age=60")
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	defer server.Close()
+
+	for _, data := range []struct {
+		Option        kioto.ClientOption
+		ExpectedCalls int
+	}{
+		// executed before URL is set, cache is bypassed
+		{Option: kioto.Middlewares(cache.New(cache.NewMemoryStore(10))), ExpectedCalls: 4},
+		{Option: kioto.PostMiddlewares(cache.New(cache.NewMemoryStore(10))), ExpectedCalls: 2},
+	} {
+		calls = 0
+		client := kioto.New(data.Option)
+		for _, path := range []string{"/first", "/second", "/first", "/second"} {
+			resp, err := client.Request().Get().URL(server.URL + path).Send()
+			require.NoError(t, err)
+			body, err := resp.String()
+			require.NoError(t, err)
+			assert.Equal(t, path, body)
+		}
+		assert.Equal(t, data.ExpectedCalls, calls)
+	}
+}
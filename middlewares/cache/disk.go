@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// DiskStore is Store that keeps every entry as JSON file in a directory.
+// File names are derived from hash of entry key.
+type DiskStore struct {
+	dir string
+}
+
+// NewDiskStore creates new store that keeps entries in provided directory.
+// Directory is created if it does not exist.
+func NewDiskStore(dir string) (*DiskStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &DiskStore{dir: dir}, nil
+}
+
+// Get is implementation of Store interface.
+func (s *DiskStore) Get(key string) (*Entry, bool, error) {
+	data, err := ioutil.ReadFile(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	entry := new(Entry)
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, false, err
+	}
+	return entry, true, nil
+}
+
+// Set is implementation of Store interface. Entry is first written to
+// temporary file and then renamed, so readers never see partial entry.
+func (s *DiskStore) Set(key string, entry *Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(s.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(key))
+}
+
+// Delete is implementation of Store interface.
+func (s *DiskStore) Delete(key string) error {
+	err := os.Remove(s.path(key))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *DiskStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+".json")
+}
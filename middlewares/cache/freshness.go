@@ -0,0 +1,157 @@
+package cache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheControl holds parsed directives of Cache-Control header. Directives
+// without value are stored with empty string value.
+type cacheControl map[string]string
+
+func parseCacheControl(header http.Header) cacheControl {
+	cc := make(cacheControl)
+	for _, line := range header.Values("Cache-Control") {
+		for _, part := range strings.Split(line, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			name, value := part, ""
+			if i := strings.Index(part, "="); i >= 0 {
+				name, value = part[:i], strings.Trim(strings.TrimSpace(part[i+1:]), `"`)
+			}
+			cc[strings.ToLower(strings.TrimSpace(name))] = value
+		}
+	}
+	return cc
+}
+
+// has checks if directive is present.
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+// duration returns value of directive as duration in seconds. Boolean return
+// value indicates if directive is present and valid.
+func (cc cacheControl) duration(directive string) (time.Duration, bool) {
+	value, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// date returns date from header with provided name, or zero time if header
+// is missing or invalid.
+func date(header http.Header, name string) time.Time {
+	value := header.Get(name)
+	if value == "" {
+		return time.Time{}
+	}
+	t, err := http.ParseTime(value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// freshnessLifetime returns for how long entry is fresh, as defined in
+// RFC 7234 section 4.2.1. If response does not define explicit expiration
+// time, heuristic based on Last-Modified header is used.
+func (e *Entry) freshnessLifetime() time.Duration {
+	cc := parseCacheControl(e.Header)
+	if maxAge, ok := cc.duration("max-age"); ok {
+		return maxAge
+	}
+
+	responseDate := date(e.Header, "Date")
+	if responseDate.IsZero() {
+		responseDate = e.ResponseTime
+	}
+
+	if e.Header.Get("Expires") != "" {
+		expires := date(e.Header, "Expires")
+		// invalid Expires value means that response is already expired
+		if expires.IsZero() || expires.Before(responseDate) {
+			return 0
+		}
+		return expires.Sub(responseDate)
+	}
+
+	if lastModified := date(e.Header, "Last-Modified"); !lastModified.IsZero() && lastModified.Before(responseDate) {
+		return responseDate.Sub(lastModified) / 10
+	}
+	return 0
+}
+
+// age returns current age of entry, as defined in RFC 7234 section 4.2.3.
+func (e *Entry) age(now time.Time) time.Duration {
+	var apparentAge time.Duration
+	if responseDate := date(e.Header, "Date"); !responseDate.IsZero() && e.ResponseTime.After(responseDate) {
+		apparentAge = e.ResponseTime.Sub(responseDate)
+	}
+
+	var ageValue time.Duration
+	if seconds, err := strconv.ParseInt(e.Header.Get("Age"), 10, 64); err == nil && seconds > 0 {
+		ageValue = time.Duration(seconds) * time.Second
+	}
+	correctedAge := ageValue + e.ResponseTime.Sub(e.RequestTime)
+
+	initialAge := apparentAge
+	if correctedAge > initialAge {
+		initialAge = correctedAge
+	}
+	return initialAge + now.Sub(e.ResponseTime)
+}
+
+// fresh checks if entry can be served without revalidation for request
+// with provided Cache-Control directives.
+func (e *Entry) fresh(reqCC cacheControl, now time.Time) bool {
+	if reqCC.has("no-cache") || parseCacheControl(e.Header).has("no-cache") {
+		return false
+	}
+	lifetime := e.freshnessLifetime()
+	if maxAge, ok := reqCC.duration("max-age"); ok && maxAge < lifetime {
+		lifetime = maxAge
+	}
+	age := e.age(now)
+	if minFresh, ok := reqCC.duration("min-fresh"); ok {
+		age += minFresh
+	}
+	return age < lifetime
+}
+
+// staleAllowedOnError checks if entry can be served when origin fails,
+// according to stale-if-error directive (RFC 5861) from request, response
+// or provided default. Responses with must-revalidate, proxy-revalidate or
+// no-cache are never served stale (RFC 7234 section 4.2.4).
+func (e *Entry) staleAllowedOnError(reqCC cacheControl, defaultStale time.Duration, now time.Time) bool {
+	respCC := parseCacheControl(e.Header)
+	if respCC.has("must-revalidate") || respCC.has("proxy-revalidate") || respCC.has("no-cache") {
+		return false
+	}
+	allowed := defaultStale
+	if d, ok := respCC.duration("stale-if-error"); ok {
+		allowed = d
+	}
+	if d, ok := reqCC.duration("stale-if-error"); ok {
+		allowed = d
+	}
+	if allowed <= 0 {
+		return false
+	}
+	return e.age(now)-e.freshnessLifetime() <= allowed
+}
+
+// hasValidators checks if entry can be revalidated with conditional request.
+func (e *Entry) hasValidators() bool {
+	return e.Header.Get("ETag") != "" || e.Header.Get("Last-Modified") != ""
+}
@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCacheControl(t *testing.T) {
+	header := http.Header{}
+	header.Add("Cache-Control", `public, max-age=60, no-cache="Set-Cookie"`)
+	header.Add("Cache-Control", "Stale-If-Error=10")
+	cc := parseCacheControl(header)
+
+	assert.True(t, cc.has("public"))
+	assert.Equal(t, "Set-Cookie", cc["no-cache"])
+	maxAge, ok := cc.duration("max-age")
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, maxAge)
+	stale, ok := cc.duration("stale-if-error")
+	assert.True(t, ok)
+	assert.Equal(t, 10*time.Second, stale)
+	_, ok = cc.duration("public")
+	assert.False(t, ok)
+}
+
+func TestFreshnessLifetime(t *testing.T) {
+	responseTime := time.Date(2018, time.November, 20, 10, 0, 0, 0, time.UTC)
+	format := func(t time.Time) string { return t.Format(http.TimeFormat) }
+	for _, data := range []struct {
+		Header   http.Header
+		Expected time.Duration
+	}{
+		{
+			Header:   http.Header{"Cache-Control": {"max-age=120"}, "Expires": {format(responseTime.Add(time.Hour))}},
+			Expected: 2 * time.Minute,
+		},
+		{
+			Header:   http.Header{"Date": {format(responseTime)}, "Expires": {format(responseTime.Add(time.Hour))}},
+			Expected: time.Hour,
+		},
+		{
+			Header:   http.Header{"Expires": {"0"}},
+			Expected: 0,
+		},
+		{
+			Header:   http.Header{"Last-Modified": {format(responseTime.Add(-10 * time.Hour))}},
+			Expected: time.Hour,
+		},
+		{
+			Header:   http.Header{},
+			Expected: 0,
+		},
+	} {
+		entry := &Entry{Header: data.Header, RequestTime: responseTime, ResponseTime: responseTime}
+		assert.Equal(t, data.Expected, entry.freshnessLifetime(), "headers: %v", data.Header)
+	}
+}
+
+func TestAge(t *testing.T) {
+	responseTime := time.Date(2018, time.November, 20, 10, 0, 0, 0, time.UTC)
+	entry := &Entry{
+		Header: http.Header{
+			"Date": {responseTime.Add(-5 * time.Second).Format(http.TimeFormat)},
+			"Age":  {"10"},
+		},
+		RequestTime:  responseTime.Add(-time.Second),
+		ResponseTime: responseTime,
+	}
+	// corrected age (10s + 1s of response delay) is larger than apparent age (5s)
+	assert.Equal(t, 11*time.Second+time.Minute, entry.age(responseTime.Add(time.Minute)))
+}
+
+func TestFresh(t *testing.T) {
+	now := time.Now()
+	entry := &Entry{
+		Header:       http.Header{"Cache-Control": {"max-age=60"}},
+		RequestTime:  now.Add(-30 * time.Second),
+		ResponseTime: now.Add(-30 * time.Second),
+	}
+	assert.True(t, entry.fresh(cacheControl{}, now))
+	assert.False(t, entry.fresh(cacheControl{"no-cache": ""}, now))
+	assert.False(t, entry.fresh(cacheControl{"max-age": "10"}, now))
+	assert.False(t, entry.fresh(cacheControl{"min-fresh": "40"}, now))
+	assert.False(t, entry.fresh(cacheControl{}, now.Add(time.Minute)))
+}
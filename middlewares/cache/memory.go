@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// MemoryStore is Store that keeps entries in memory and evicts least
+// recently used ones when capacity is reached.
+type MemoryStore struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	items    map[string]*list.Element
+}
+
+type memoryItem struct {
+	key   string
+	entry *Entry
+}
+
+// NewMemoryStore creates new in-memory LRU store that holds at most capacity
+// entries. Capacity of zero or less means that store is not limited.
+func NewMemoryStore(capacity int) *MemoryStore {
+	return &MemoryStore{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// Get is implementation of Store interface.
+func (s *MemoryStore) Get(key string) (*Entry, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elem, ok := s.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	s.order.MoveToFront(elem)
+	return elem.Value.(*memoryItem).entry, true, nil
+}
+
+// Set is implementation of Store interface.
+func (s *MemoryStore) Set(key string, entry *Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if elem, ok := s.items[key]; ok {
+		elem.Value.(*memoryItem).entry = entry
+		s.order.MoveToFront(elem)
+		return nil
+	}
+	s.items[key] = s.order.PushFront(&memoryItem{key: key, entry: entry})
+	if s.capacity > 0 && s.order.Len() > s.capacity {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.items, oldest.Value.(*memoryItem).key)
+	}
+	return nil
+}
+
+// Delete is implementation of Store interface.
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if elem, ok := s.items[key]; ok {
+		s.order.Remove(elem)
+		delete(s.items, key)
+	}
+	return nil
+}
+
+// Len returns number of entries currently in store.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.order.Len()
+}
@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Store defines storage for cached responses. Implementations have to be
+// safe for concurrent use.
+type Store interface {
+	// Get returns entry stored under provided key. Boolean return value
+	// indicates if entry was found.
+	Get(key string) (entry *Entry, ok bool, err error)
+	// Set stores entry under provided key, replacing existing one.
+	Set(key string, entry *Entry) error
+	// Delete removes entry with provided key. Deleting missing entry is
+	// not an error.
+	Delete(key string) error
+}
+
+// Entry is single cached response together with information needed to
+// calculate its freshness.
+type Entry struct {
+	StatusCode int         `json:"status_code"`
+	Status     string      `json:"status"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	// RequestTime is time when request that produced response was sent.
+	RequestTime time.Time `json:"request_time"`
+	// ResponseTime is time when response was received.
+	ResponseTime time.Time `json:"response_time"`
+	// Vary holds values of request headers nominated by Vary response
+	// header, at the time response was stored.
+	Vary http.Header `json:"vary,omitempty"`
+}
+
+// clone returns deep copy of entry, so that it can be modified without
+// affecting copy held by store.
+func (e *Entry) clone() *Entry {
+	c := *e
+	c.Header = e.Header.Clone()
+	c.Vary = e.Vary.Clone()
+	return &c
+}
+
+// response creates HTTP response for provided request from entry.
+func (e *Entry) response(req *http.Request, now time.Time, status string) *http.Response {
+	header := e.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Set("Age", strconv.FormatInt(int64(e.age(now)/time.Second), 10))
+	header.Set(StatusHeader, status)
+	return &http.Response{
+		Status:        e.Status,
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,84 @@
+package cache_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/delicb/kioto/middlewares/cache"
+)
+
+func testEntry(body string) *cache.Entry {
+	now := time.Now().UTC().Truncate(time.Second)
+	return &cache.Entry{
+		StatusCode:   200,
+		Status:       "200 OK",
+		Header:       http.Header{"Content-Type": {"text/plain"}},
+		Body:         []byte(body),
+		RequestTime:  now,
+		ResponseTime: now,
+		Vary:         http.Header{"Accept": {"text/plain"}},
+	}
+}
+
+func testStore(t *testing.T, store cache.Store) {
+	_, ok, err := store.Get("missing")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	entry := testEntry("content")
+	require.NoError(t, store.Set("key", entry))
+	got, ok, err := store.Get("key")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, entry.StatusCode, got.StatusCode)
+	assert.Equal(t, entry.Header, got.Header)
+	assert.Equal(t, entry.Body, got.Body)
+	assert.Equal(t, entry.Vary, got.Vary)
+	assert.True(t, entry.ResponseTime.Equal(got.ResponseTime))
+
+	require.NoError(t, store.Set("key", testEntry("updated")))
+	got, _, err = store.Get("key")
+	require.NoError(t, err)
+	assert.Equal(t, "updated", string(got.Body))
+
+	require.NoError(t, store.Delete("key"))
+	require.NoError(t, store.Delete("key"))
+	_, ok, err = store.Get("key")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, cache.NewMemoryStore(10))
+}
+
+func TestMemoryStoreEviction(t *testing.T) {
+	store := cache.NewMemoryStore(2)
+	require.NoError(t, store.Set("first", testEntry("first")))
+	require.NoError(t, store.Set("second", testEntry("second")))
+	// use first entry, so that second is least recently used
+	_, _, _ = store.Get("first")
+	require.NoError(t, store.Set("third", testEntry("third")))
+
+	assert.Equal(t, 2, store.Len())
+	_, ok, _ := store.Get("second")
+	assert.False(t, ok, "least recently used entry not evicted")
+	_, ok, _ = store.Get("first")
+	assert.True(t, ok)
+}
+
+func TestDiskStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kioto-cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	store, err := cache.NewDiskStore(dir)
+	require.NoError(t, err)
+	testStore(t, store)
+}
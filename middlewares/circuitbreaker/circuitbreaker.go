@@ -0,0 +1,293 @@
+// Package circuitbreaker contains middleware that stops sending requests to
+// destinations that keep failing, giving them time to recover.
+package circuitbreaker
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	c "github.com/delicb/kioto/cliware"
+	"github.com/delicb/kioto/middlewares/retry"
+)
+
+var (
+	defaultThreshold        = 5
+	defaultOpenTimeout      = 30 * time.Second
+	defaultHalfOpenRequests = 1
+	defaultClassifier       = Classifier(retry.ErrorOr500Plus)
+)
+
+// State is state of a single circuit.
+type State int
+
+const (
+	// Closed is state in which requests are sent normally and failures are
+	// counted.
+	Closed State = iota
+	// Open is state in which all requests are rejected with ErrCircuitOpen.
+	Open
+	// HalfOpen is state in which limited number of trial requests is sent to
+	// determine if destination recovered.
+	HalfOpen
+)
+
+// String implements Stringer interface for State.
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// Classifier is function that determines if request failed. It has same
+// shape as retry.Classifier, so classifiers from retry package can be used.
+type Classifier func(resp *http.Response, err error) (failure bool)
+
+// ErrCircuitOpen is error returned when request is rejected because circuit
+// for its key is open (or half-open with all trial requests in flight).
+type ErrCircuitOpen struct {
+	Key   string
+	State State
+}
+
+// Error is implementation of error interface for ErrCircuitOpen.
+func (e *ErrCircuitOpen) Error() string {
+	return fmt.Sprintf("circuit breaker: circuit for %q is %s", e.Key, e.State)
+}
+
+// ErrNoKey is returned when key of circuit can not be determined for request,
+// e.g. when breaker is executed before request URL is set. Request is not
+// sent, since grouping all such requests in single circuit would let one
+// failing destination reject requests to all others.
+var ErrNoKey = errors.New("circuit breaker: request has no circuit key")
+
+// Option is function that configures Breaker.
+type Option func(b *Breaker)
+
+// Threshold sets number of consecutive failures after which circuit opens.
+func Threshold(failures int) Option {
+	return func(b *Breaker) {
+		b.threshold = failures
+	}
+}
+
+// OpenTimeout sets for how long circuit stays open before trial requests
+// are allowed.
+func OpenTimeout(timeout time.Duration) Option {
+	return func(b *Breaker) {
+		b.openTimeout = timeout
+	}
+}
+
+// HalfOpenRequests sets number of trial requests allowed while circuit is
+// half-open. If all of them succeed, circuit closes. If any fails, circuit
+// opens again.
+func HalfOpenRequests(requests int) Option {
+	return func(b *Breaker) {
+		b.halfOpenRequests = requests
+	}
+}
+
+// SetClassifier sets classifier used to determine if request failed.
+// By default, errors and responses with status code 500 or higher are
+// considered failures.
+func SetClassifier(classifier func(resp *http.Response, err error) bool) Option {
+	return func(b *Breaker) {
+		b.classifier = Classifier(classifier)
+	}
+}
+
+// KeyFunc sets function that determines key of circuit to which request
+// belongs. By default, requests are grouped per URL host. Requests for which
+// key function returns empty string are rejected with ErrNoKey.
+func KeyFunc(keyFunc func(req *http.Request) string) Option {
+	return func(b *Breaker) {
+		b.keyFunc = keyFunc
+	}
+}
+
+// OnStateChange sets function that is called every time circuit changes
+// state. It is called synchronously, after breaker lock is released.
+func OnStateChange(callback func(key string, from, to State)) Option {
+	return func(b *Breaker) {
+		b.onStateChange = callback
+	}
+}
+
+// Breaker is cliware.Middleware that tracks failures per key and rejects
+// requests for keys that are failing. Same instance should be used for
+// all requests to share state. Since default key is URL host, which is set by
+// request specific middlewares, breaker should be added to client with
+// Client.UsePost (or kioto.PostMiddlewares option).
+type Breaker struct {
+	threshold        int
+	openTimeout      time.Duration
+	halfOpenRequests int
+	classifier       Classifier
+	keyFunc          func(req *http.Request) string
+	onStateChange    func(key string, from, to State)
+	now              func() time.Time
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	state     State
+	failures  int
+	openedAt  time.Time
+	inFlight  int
+	successes int
+}
+
+type transition struct {
+	key      string
+	from, to State
+}
+
+// New creates new Breaker configured with provided options.
+func New(options ...Option) *Breaker {
+	b := &Breaker{
+		threshold:        defaultThreshold,
+		openTimeout:      defaultOpenTimeout,
+		halfOpenRequests: defaultHalfOpenRequests,
+		classifier:       defaultClassifier,
+		keyFunc:          hostKey,
+		now:              time.Now,
+		circuits:         make(map[string]*circuit),
+	}
+	for _, opt := range options {
+		opt(b)
+	}
+	return b
+}
+
+// Exec is implementation of cliware.Middleware interface.
+func (b *Breaker) Exec(next c.Handler) c.Handler {
+	return c.HandlerFunc(func(req *http.Request) (resp *http.Response, err error) {
+		key := b.keyFunc(req)
+		if key == "" {
+			return nil, ErrNoKey
+		}
+		trial, err := b.allow(key)
+		if err != nil {
+			return nil, err
+		}
+		resp, err = next.Handle(req)
+		b.record(key, trial, b.classifier(resp, err))
+		return resp, err
+	})
+}
+
+// State returns current state of circuit for provided key.
+func (b *Breaker) State(key string) State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cir, ok := b.circuits[key]
+	if !ok {
+		return Closed
+	}
+	if cir.state == Open && b.now().Sub(cir.openedAt) >= b.openTimeout {
+		return HalfOpen
+	}
+	return cir.state
+}
+
+// allow checks if request for provided key can be sent. Returned boolean
+// indicates if request is trial request in half-open state.
+func (b *Breaker) allow(key string) (trial bool, err error) {
+	var transitions []transition
+	defer func() { b.notify(transitions) }()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	cir, ok := b.circuits[key]
+	if !ok {
+		cir = &circuit{state: Closed}
+		b.circuits[key] = cir
+	}
+
+	if cir.state == Open && b.now().Sub(cir.openedAt) >= b.openTimeout {
+		transitions = append(transitions, b.setState(key, cir, HalfOpen))
+	}
+
+	switch cir.state {
+	case Open:
+		return false, &ErrCircuitOpen{Key: key, State: Open}
+	case HalfOpen:
+		if cir.inFlight+cir.successes >= b.halfOpenRequests {
+			return false, &ErrCircuitOpen{Key: key, State: HalfOpen}
+		}
+		cir.inFlight++
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// record updates circuit for provided key with result of a request.
+func (b *Breaker) record(key string, trial bool, failure bool) {
+	var transitions []transition
+	defer func() { b.notify(transitions) }()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	cir := b.circuits[key]
+	if trial {
+		cir.inFlight--
+	}
+
+	switch {
+	case cir.state == Closed && failure:
+		cir.failures++
+		if cir.failures >= b.threshold {
+			transitions = append(transitions, b.setState(key, cir, Open))
+		}
+	case cir.state == Closed:
+		cir.failures = 0
+	case cir.state == HalfOpen && trial && failure:
+		transitions = append(transitions, b.setState(key, cir, Open))
+	case cir.state == HalfOpen && trial:
+		cir.successes++
+		if cir.successes >= b.halfOpenRequests {
+			transitions = append(transitions, b.setState(key, cir, Closed))
+		}
+	}
+}
+
+// setState changes state of provided circuit and resets its counters.
+// Must be called with lock held.
+func (b *Breaker) setState(key string, cir *circuit, state State) transition {
+	t := transition{key: key, from: cir.state, to: state}
+	cir.state = state
+	cir.failures = 0
+	cir.successes = 0
+	if state == Open {
+		cir.openedAt = b.now()
+	}
+	return t
+}
+
+func (b *Breaker) notify(transitions []transition) {
+	if b.onStateChange == nil {
+		return
+	}
+	for _, t := range transitions {
+		b.onStateChange(t.key, t.from, t.to)
+	}
+}
+
+func hostKey(req *http.Request) string {
+	return req.URL.Host
+}
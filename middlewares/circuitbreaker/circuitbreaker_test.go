@@ -0,0 +1,204 @@
+package circuitbreaker_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/delicb/kioto"
+	"github.com/delicb/kioto/cliware"
+	"github.com/delicb/kioto/middlewares/circuitbreaker"
+)
+
+type stubHandler struct {
+	calls  int
+	status int
+	err    error
+}
+
+func (h *stubHandler) Handle(req *http.Request) (*http.Response, error) {
+	h.calls++
+	if h.err != nil {
+		return nil, h.err
+	}
+	return &http.Response{StatusCode: h.status, Request: req}, nil
+}
+
+func request(host string) *http.Request {
+	req := cliware.EmptyRequest()
+	req.URL = &url.URL{Scheme: "https", Host: host, Path: "/"}
+	return req
+}
+
+func TestBreakerOpensAfterThreshold(t *testing.T) {
+	handler := &stubHandler{err: errors.New("connection refused")}
+	breaker := circuitbreaker.New(circuitbreaker.Threshold(3), circuitbreaker.OpenTimeout(time.Hour))
+	h := breaker.Exec(handler)
+
+	for i := 0; i < 3; i++ {
+		if _, err := h.Handle(request("delic.rs")); err != handler.err {
+			t.Fatalf("Wrong error on request %d: %v", i, err)
+		}
+	}
+	if state := breaker.State("delic.rs"); state != circuitbreaker.Open {
+		t.Errorf("Wrong state. Got: %s, expected: %s.", state, circuitbreaker.Open)
+	}
+
+	_, err := h.Handle(request("delic.rs"))
+	openErr, ok := err.(*circuitbreaker.ErrCircuitOpen)
+	if !ok {
+		t.Fatalf("Wrong error type. Expected ErrCircuitOpen, got: %T", err)
+	}
+	if openErr.Key != "delic.rs" {
+		t.Errorf("Wrong key in error. Got: %s, expected: delic.rs.", openErr.Key)
+	}
+	if handler.calls != 3 {
+		t.Errorf("Wrong number of calls. Got: %d, expected: 3.", handler.calls)
+	}
+
+	// other hosts are not affected
+	handler.err = nil
+	handler.status = 200
+	if _, err := h.Handle(request("golang.org")); err != nil {
+		t.Error("Unexpected error for other host:", err)
+	}
+}
+
+func TestBreakerSuccessResetsFailures(t *testing.T) {
+	handler := &stubHandler{status: 500}
+	breaker := circuitbreaker.New(circuitbreaker.Threshold(2))
+	h := breaker.Exec(handler)
+
+	for _, status := range []int{500, 200, 500, 200, 500} {
+		handler.status = status
+		if _, err := h.Handle(request("delic.rs")); err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+	}
+	if state := breaker.State("delic.rs"); state != circuitbreaker.Closed {
+		t.Errorf("Wrong state. Got: %s, expected: %s.", state, circuitbreaker.Closed)
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	type change struct{ from, to circuitbreaker.State }
+	var changes []change
+
+	handler := &stubHandler{status: 503}
+	breaker := circuitbreaker.New(
+		circuitbreaker.Threshold(1),
+		circuitbreaker.OpenTimeout(10*time.Millisecond),
+		circuitbreaker.HalfOpenRequests(2),
+		circuitbreaker.OnStateChange(func(key string, from, to circuitbreaker.State) {
+			changes = append(changes, change{from, to})
+		}),
+	)
+	h := breaker.Exec(handler)
+
+	_, _ = h.Handle(request("delic.rs"))
+	time.Sleep(20 * time.Millisecond)
+	if state := breaker.State("delic.rs"); state != circuitbreaker.HalfOpen {
+		t.Errorf("Wrong state. Got: %s, expected: %s.", state, circuitbreaker.HalfOpen)
+	}
+
+	// failed trial opens circuit again
+	_, _ = h.Handle(request("delic.rs"))
+	if _, err := h.Handle(request("delic.rs")); err == nil {
+		t.Error("Expected request to be rejected after failed trial.")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	handler.status = 200
+	for i := 0; i < 2; i++ {
+		if _, err := h.Handle(request("delic.rs")); err != nil {
+			t.Fatalf("Unexpected error for trial %d: %v", i, err)
+		}
+	}
+	if state := breaker.State("delic.rs"); state != circuitbreaker.Closed {
+		t.Errorf("Wrong state. Got: %s, expected: %s.", state, circuitbreaker.Closed)
+	}
+
+	expected := []change{
+		{circuitbreaker.Closed, circuitbreaker.Open},
+		{circuitbreaker.Open, circuitbreaker.HalfOpen},
+		{circuitbreaker.HalfOpen, circuitbreaker.Open},
+		{circuitbreaker.Open, circuitbreaker.HalfOpen},
+		{circuitbreaker.HalfOpen, circuitbreaker.Closed},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("Wrong state changes. Got: %v, expected: %v.", changes, expected)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("Wrong state change %d. Got: %v, expected: %v.", i, changes[i], expected[i])
+		}
+	}
+}
+
+func TestBreakerKeyFuncAndClassifier(t *testing.T) {
+	handler := &stubHandler{status: 404}
+	breaker := circuitbreaker.New(
+		circuitbreaker.Threshold(1),
+		circuitbreaker.KeyFunc(func(req *http.Request) string { return req.URL.Path }),
+		circuitbreaker.SetClassifier(func(resp *http.Response, err error) bool {
+			return err != nil || resp.StatusCode == 404
+		}),
+	)
+	h := breaker.Exec(handler)
+	_, _ = h.Handle(request("delic.rs"))
+	if state := breaker.State("/"); state != circuitbreaker.Open {
+		t.Errorf("Wrong state. Got: %s, expected: %s.", state, circuitbreaker.Open)
+	}
+}
+
+func TestBreakerWithClient(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer healthy.Close()
+
+	breaker := circuitbreaker.New(circuitbreaker.Threshold(2), circuitbreaker.OpenTimeout(time.Hour))
+	client := kioto.New(kioto.DisableRetry(), kioto.PostMiddlewares(breaker))
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Request().Get().URL(failing.URL).Send()
+		if err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+		resp.Body.Close()
+	}
+
+	_, err := client.Request().Get().URL(failing.URL).Send()
+	if _, ok := err.(*circuitbreaker.ErrCircuitOpen); !ok {
+		t.Errorf("Expected ErrCircuitOpen for failing server, got: %v.", err)
+	}
+
+	resp, err := client.Request().Get().URL(healthy.URL).Send()
+	if err != nil {
+		t.Fatal("Request to healthy server rejected:", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Wrong status code. Got: %d, expected: 200.", resp.StatusCode)
+	}
+}
+
+func TestBreakerNoKey(t *testing.T) {
+	handler := &stubHandler{status: 200}
+	// added with Use, breaker is executed before URL is set
+	client := kioto.New(kioto.DisableRetry(), kioto.Middlewares(circuitbreaker.New()))
+	_, err := client.Request().Use(cliware.MiddlewareFunc(func(next cliware.Handler) cliware.Handler {
+		return handler
+	})).URL("http://delic.rs").Send()
+	if err != circuitbreaker.ErrNoKey {
+		t.Errorf("Wrong error. Got: %v, expected: %v.", err, circuitbreaker.ErrNoKey)
+	}
+	if handler.calls != 0 {
+		t.Error("Request without key sent.")
+	}
+}
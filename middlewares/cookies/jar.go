@@ -0,0 +1,383 @@
+package cookies
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	c "github.com/delicb/kioto/cliware"
+)
+
+// Entry is cookie stored in Jar, in form suitable for inspection and
+// persistence.
+type Entry struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	// Domain is domain cookie belongs to, without leading dot.
+	Domain string `json:"domain"`
+	Path   string `json:"path"`
+	// HostOnly is true if cookie did not have Domain attribute, so it is
+	// sent only to host that set it and not to its subdomains.
+	HostOnly bool `json:"host_only,omitempty"`
+	Secure   bool `json:"secure,omitempty"`
+	HttpOnly bool `json:"http_only,omitempty"`
+	// SameSite holds value of SameSite attribute.
+	SameSite http.SameSite `json:"same_site,omitempty"`
+	// Expires is time when cookie expires. It is zero for session cookies.
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+func (e *Entry) key() string {
+	return e.Domain + ";" + e.Path + ";" + e.Name
+}
+
+func (e *Entry) expired(now time.Time) bool {
+	return !e.Expires.IsZero() && !e.Expires.After(now)
+}
+
+// ErrNoPublicSuffixList is returned by NewJar when neither PublicSuffixList
+// nor AllowAnyDomain option is used.
+var ErrNoPublicSuffixList = errors.New("cookies: jar requires public suffix list (see PublicSuffixList and AllowAnyDomain options)")
+
+// JarOption configures Jar.
+type JarOption func(*Jar)
+
+// PublicSuffixList sets public suffix list used by jar to reject cookies set
+// for public suffixes (e.g. "co.uk"), so that one site can not set cookies for
+// other sites. Implementation is available in golang.org/x/net/publicsuffix.
+func PublicSuffixList(list cookiejar.PublicSuffixList) JarOption {
+	return func(j *Jar) {
+		j.psl = list
+	}
+}
+
+// AllowAnyDomain allows jar to be created without public suffix list. Such
+// jar accepts cookies for any domain the host belongs to, e.g. host
+// "foo.co.uk" can set cookies for "bar.co.uk", so it should be used only when
+// talking to trusted hosts.
+func AllowAnyDomain() JarOption {
+	return func(j *Jar) {
+		j.allowAnyDomain = true
+	}
+}
+
+// Persist sets path of JSON file in which cookies are kept between runs.
+// Cookies are loaded from file (if it exists) when jar is created, and
+// written to it by Save. Session cookies are persisted as well.
+func Persist(path string) JarOption {
+	return func(j *Jar) {
+		j.path = path
+	}
+}
+
+// Jar stores cookies received in responses and adds them to subsequent
+// requests. It is backed by net/http/cookiejar, with additional support for
+// inspecting, clearing and persisting stored cookies.
+//
+// Jar implements http.CookieJar, so it can be set as Jar of http.Client, which
+// also stores cookies from redirect responses. It is also middleware that can
+// be used with other doers or with single request. Since it needs request URL,
+// when added to client directly it should be added with Client.UsePost.
+// kioto.CookieJar option picks appropriate way automatically.
+type Jar struct {
+	mu      sync.RWMutex
+	jar     *cookiejar.Jar
+	entries map[string]*Entry
+	psl     cookiejar.PublicSuffixList
+	path    string
+
+	allowAnyDomain bool
+	now            func() time.Time
+}
+
+// NewJar creates new cookie jar configured with provided options. Public
+// suffix list is required, unless AllowAnyDomain option is used. Error is
+// also returned if file set by Persist option exists, but can not be loaded.
+func NewJar(opts ...JarOption) (*Jar, error) {
+	j := &Jar{
+		entries: make(map[string]*Entry),
+		now:     time.Now,
+	}
+	for _, opt := range opts {
+		opt(j)
+	}
+	if j.psl == nil && !j.allowAnyDomain {
+		return nil, ErrNoPublicSuffixList
+	}
+	j.jar = j.newCookieJar()
+	if j.path == "" {
+		return j, nil
+	}
+
+	data, err := ioutil.ReadFile(j.path)
+	if os.IsNotExist(err) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	j.Import(entries)
+	return j, nil
+}
+
+func (j *Jar) newCookieJar() *cookiejar.Jar {
+	// error is never returned from cookiejar.New
+	jar, _ := cookiejar.New(&cookiejar.Options{PublicSuffixList: j.psl})
+	return jar
+}
+
+// Exec implements cliware.Middleware interface. It adds cookies stored in jar
+// to request and stores cookies received in response.
+func (j *Jar) Exec(next c.Handler) c.Handler {
+	return c.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		for _, cookie := range j.Cookies(req.URL) {
+			req.AddCookie(cookie)
+		}
+		resp, err := next.Handle(req)
+		if resp != nil {
+			u := req.URL
+			if resp.Request != nil && resp.Request.URL != nil {
+				// final URL, after redirects
+				u = resp.Request.URL
+			}
+			if cookies := resp.Cookies(); len(cookies) > 0 {
+				j.SetCookies(u, cookies)
+			}
+		}
+		return resp, err
+	})
+}
+
+// Cookies implements http.CookieJar interface. It returns cookies that should
+// be sent in request to provided URL.
+func (j *Jar) Cookies(u *url.URL) []*http.Cookie {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.jar.Cookies(u)
+}
+
+// SetCookies implements http.CookieJar interface. It stores cookies received
+// in response from provided URL.
+func (j *Jar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.jar.SetCookies(u, cookies)
+
+	now := j.now()
+	for _, cookie := range cookies {
+		entry, ok := j.newEntry(u, cookie, now)
+		if !ok {
+			continue
+		}
+		if entry.expired(now) {
+			delete(j.entries, entry.key())
+			continue
+		}
+		j.entries[entry.key()] = entry
+	}
+}
+
+// Domains returns sorted list of domains for which jar holds cookies.
+func (j *Jar) Domains() []string {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	now := j.now()
+	seen := make(map[string]bool)
+	var domains []string
+	for _, e := range j.entries {
+		if !e.expired(now) && !seen[e.Domain] {
+			seen[e.Domain] = true
+			domains = append(domains, e.Domain)
+		}
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+// Entries returns cookies stored for provided domain. Cookies of
+// subdomains are not included.
+func (j *Jar) Entries(domain string) []Entry {
+	domain = normalizeDomain(domain)
+	return j.filter(func(e *Entry) bool {
+		return e.Domain == domain
+	})
+}
+
+// Export returns all cookies stored in jar that are not expired.
+func (j *Jar) Export() []Entry {
+	return j.filter(func(*Entry) bool { return true })
+}
+
+// Import adds provided cookies to jar. Expired cookies are ignored.
+func (j *Jar) Import(entries []Entry) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := j.now()
+	for i := range entries {
+		entry := entries[i]
+		if entry.expired(now) {
+			continue
+		}
+		entry.Domain = normalizeDomain(entry.Domain)
+		j.entries[entry.key()] = &entry
+		j.add(&entry)
+	}
+}
+
+// Clear removes cookies stored for provided domain and its subdomains.
+func (j *Jar) Clear(domain string) {
+	domain = normalizeDomain(domain)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for key, e := range j.entries {
+		if e.Domain == domain || strings.HasSuffix(e.Domain, "."+domain) {
+			delete(j.entries, key)
+		}
+	}
+	j.rebuild()
+}
+
+// ClearAll removes all cookies from jar.
+func (j *Jar) ClearAll() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries = make(map[string]*Entry)
+	j.rebuild()
+}
+
+// Save writes all cookies stored in jar to file set by Persist option. It
+// does nothing if option was not used.
+func (j *Jar) Save() error {
+	if j.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(j.Export(), "", "  ")
+	if err != nil {
+		return err
+	}
+	// cookies often hold credentials, so file is readable only by owner
+	return ioutil.WriteFile(j.path, data, 0600)
+}
+
+func (j *Jar) filter(include func(*Entry) bool) []Entry {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	now := j.now()
+	entries := []Entry{}
+	for _, e := range j.entries {
+		if !e.expired(now) && include(e) {
+			entries = append(entries, *e)
+		}
+	}
+	sort.Slice(entries, func(a, b int) bool {
+		return entries[a].key() < entries[b].key()
+	})
+	return entries
+}
+
+// rebuild replaces underlying jar with one holding only tracked entries,
+// since net/http/cookiejar does not support removing cookies. Caller must
+// hold the lock.
+func (j *Jar) rebuild() {
+	j.jar = j.newCookieJar()
+	for _, e := range j.entries {
+		j.add(e)
+	}
+}
+
+// add adds entry to underlying jar. Caller must hold the lock.
+func (j *Jar) add(e *Entry) {
+	u := &url.URL{Scheme: "http", Host: e.Domain, Path: e.Path}
+	if e.Secure {
+		u.Scheme = "https"
+	}
+	cookie := &http.Cookie{
+		Name:     e.Name,
+		Value:    e.Value,
+		Path:     e.Path,
+		Secure:   e.Secure,
+		HttpOnly: e.HttpOnly,
+		SameSite: e.SameSite,
+		Expires:  e.Expires,
+	}
+	if !e.HostOnly {
+		cookie.Domain = e.Domain
+	}
+	j.jar.SetCookies(u, []*http.Cookie{cookie})
+}
+
+// newEntry creates entry for cookie received from provided URL, applying
+// the same rules as underlying jar. False is returned if cookie is rejected.
+func (j *Jar) newEntry(u *url.URL, cookie *http.Cookie, now time.Time) (*Entry, bool) {
+	if u.Scheme != "http" && u.Scheme != "https" || cookie.Name == "" {
+		return nil, false
+	}
+	host := normalizeDomain(u.Hostname())
+	entry := &Entry{
+		Name:     cookie.Name,
+		Value:    cookie.Value,
+		Domain:   host,
+		Path:     cookie.Path,
+		HostOnly: true,
+		Secure:   cookie.Secure,
+		HttpOnly: cookie.HttpOnly,
+		SameSite: cookie.SameSite,
+	}
+
+	if domain := normalizeDomain(cookie.Domain); domain != "" && domain != host {
+		if net.ParseIP(host) != nil || !strings.HasSuffix(host, "."+domain) {
+			return nil, false
+		}
+		if j.psl != nil && j.psl.PublicSuffix(domain) == domain {
+			return nil, false
+		}
+		entry.Domain = domain
+		entry.HostOnly = false
+	} else if domain != "" {
+		entry.HostOnly = false
+	}
+
+	if entry.Path == "" || entry.Path[0] != '/' {
+		entry.Path = defaultPath(u.Path)
+	}
+
+	switch {
+	case cookie.MaxAge < 0:
+		entry.Expires = now
+	case cookie.MaxAge > 0:
+		entry.Expires = now.Add(time.Duration(cookie.MaxAge) * time.Second)
+	case !cookie.Expires.IsZero():
+		entry.Expires = cookie.Expires
+	}
+	return entry, true
+}
+
+// defaultPath returns default cookie path for request path, as defined in
+// RFC 6265, section 5.1.4.
+func defaultPath(path string) string {
+	if path == "" || path[0] != '/' {
+		return "/"
+	}
+	i := strings.LastIndex(path, "/")
+	if i == 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+func normalizeDomain(domain string) string {
+	return strings.ToLower(strings.TrimPrefix(domain, "."))
+}
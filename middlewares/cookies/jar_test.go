@@ -0,0 +1,162 @@
+package cookies_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/delicb/kioto/cliware"
+	"github.com/delicb/kioto/middlewares/cookies"
+)
+
+type suffixList struct{}
+
+func (suffixList) PublicSuffix(domain string) string {
+	if strings.HasSuffix(domain, "co.uk") {
+		return "co.uk"
+	}
+	return domain[strings.LastIndex(domain, ".")+1:]
+}
+
+func (suffixList) String() string {
+	return "test"
+}
+
+func mustParse(t *testing.T, raw string) *url.URL {
+	u, err := url.Parse(raw)
+	require.NoError(t, err)
+	return u
+}
+
+func TestJarMiddleware(t *testing.T) {
+	jar, err := cookies.NewJar(cookies.AllowAnyDomain())
+	require.NoError(t, err)
+
+	var sent []*http.Cookie
+	handler := cliware.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		sent = req.Cookies()
+		header := http.Header{}
+		header.Add("Set-Cookie", "session=abc; Path=/")
+		return &http.Response{StatusCode: 200, Header: header, Request: req}, nil
+	})
+
+	req := cliware.EmptyRequest()
+	req.URL = mustParse(t, "http://example.com/login")
+	_, err = jar.Exec(handler).Handle(req)
+	require.NoError(t, err)
+	assert.Empty(t, sent)
+
+	req = cliware.EmptyRequest()
+	req.URL = mustParse(t, "http://example.com/other")
+	_, err = jar.Exec(handler).Handle(req)
+	require.NoError(t, err)
+	require.Len(t, sent, 1)
+	assert.Equal(t, "session", sent[0].Name)
+	assert.Equal(t, "abc", sent[0].Value)
+}
+
+func TestJarEntries(t *testing.T) {
+	jar, err := cookies.NewJar(cookies.PublicSuffixList(suffixList{}))
+	require.NoError(t, err)
+
+	jar.SetCookies(mustParse(t, "https://www.example.com/a/b"), []*http.Cookie{
+		{Name: "host", Value: "1"},
+		{Name: "domain", Value: "2", Domain: ".example.com", Path: "/", Secure: true, MaxAge: 3600},
+		{Name: "other", Value: "3", Domain: "other.com"},
+		{Name: "suffix", Value: "4", Domain: "com"},
+	})
+	jar.SetCookies(mustParse(t, "http://api.example.com/"), []*http.Cookie{
+		{Name: "api", Value: "5"},
+	})
+
+	assert.Equal(t, []string{"api.example.com", "example.com", "www.example.com"}, jar.Domains())
+
+	entries := jar.Entries("www.example.com")
+	require.Len(t, entries, 1)
+	assert.Equal(t, "host", entries[0].Name)
+	assert.Equal(t, "/a", entries[0].Path)
+	assert.True(t, entries[0].HostOnly)
+	assert.True(t, entries[0].Expires.IsZero())
+
+	entries = jar.Entries(".Example.com")
+	require.Len(t, entries, 1)
+	assert.Equal(t, "domain", entries[0].Name)
+	assert.False(t, entries[0].HostOnly)
+	assert.True(t, entries[0].Secure)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), entries[0].Expires, time.Minute)
+
+	assert.Len(t, jar.Export(), 3)
+
+	// deleting cookie
+	jar.SetCookies(mustParse(t, "http://api.example.com/"), []*http.Cookie{
+		{Name: "api", Value: "", MaxAge: -1},
+	})
+	assert.Empty(t, jar.Entries("api.example.com"))
+	assert.Empty(t, jar.Cookies(mustParse(t, "http://api.example.com/")))
+}
+
+func TestJarClear(t *testing.T) {
+	jar, err := cookies.NewJar(cookies.AllowAnyDomain())
+	require.NoError(t, err)
+	jar.SetCookies(mustParse(t, "http://www.example.com/"), []*http.Cookie{{Name: "a", Value: "1"}})
+	jar.SetCookies(mustParse(t, "http://example.com/"), []*http.Cookie{{Name: "b", Value: "2"}})
+	jar.SetCookies(mustParse(t, "http://example.org/"), []*http.Cookie{{Name: "c", Value: "3"}})
+
+	jar.Clear("example.com")
+	assert.Equal(t, []string{"example.org"}, jar.Domains())
+	assert.Empty(t, jar.Cookies(mustParse(t, "http://www.example.com/")))
+	assert.Len(t, jar.Cookies(mustParse(t, "http://example.org/")), 1)
+
+	jar.ClearAll()
+	assert.Empty(t, jar.Domains())
+	assert.Empty(t, jar.Cookies(mustParse(t, "http://example.org/")))
+}
+
+func TestJarPersist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kioto-cookies")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cookies.json")
+
+	jar, err := cookies.NewJar(cookies.AllowAnyDomain(), cookies.Persist(path))
+	require.NoError(t, err)
+	jar.SetCookies(mustParse(t, "https://example.com/"), []*http.Cookie{
+		{Name: "session", Value: "abc", Domain: "example.com", Secure: true},
+		{Name: "expired", Value: "x", Expires: time.Now().Add(-time.Hour)},
+	})
+	require.NoError(t, jar.Save())
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	loaded, err := cookies.NewJar(cookies.AllowAnyDomain(), cookies.Persist(path))
+	require.NoError(t, err)
+	assert.Equal(t, jar.Export(), loaded.Export())
+	got := loaded.Cookies(mustParse(t, "https://sub.example.com/"))
+	require.Len(t, got, 1)
+	assert.Equal(t, "abc", got[0].Value)
+	assert.Empty(t, loaded.Cookies(mustParse(t, "http://example.com/")), "secure cookie sent over http")
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("not json"), 0600))
+	_, err = cookies.NewJar(cookies.AllowAnyDomain(), cookies.Persist(path))
+	assert.Error(t, err)
+}
+
+func TestJarRequiresPublicSuffixList(t *testing.T) {
+	_, err := cookies.NewJar()
+	assert.Equal(t, cookies.ErrNoPublicSuffixList, err)
+
+	jar, err := cookies.NewJar(cookies.PublicSuffixList(suffixList{}))
+	require.NoError(t, err)
+	jar.SetCookies(mustParse(t, "http://foo.co.uk/"), []*http.Cookie{{Name: "a", Value: "1", Domain: "co.uk"}})
+	assert.Empty(t, jar.Cookies(mustParse(t, "http://bar.co.uk/")))
+}
@@ -3,7 +3,9 @@ package errors
 
 import (
 	"fmt"
+	"io"
 	"net/http"
+	"strings"
 
 	"io/ioutil"
 
@@ -17,30 +19,66 @@ type HTTPError struct {
 	RequestURL string
 	Method     string
 	Body       []byte
+	// Problem holds parsed problem details (RFC 7807), if response content
+	// type was application/problem+json or application/problem+xml.
+	Problem *ProblemDetails
+	// Payload holds decoded response body, if body type is registered for
+	// status code in Mapper.
+	Payload interface{}
 }
 
 // Error is implementation of error interface for HTTPError. It returns basic
-// information about error that occurred (status code, requested URL)
+// information about error that occurred (status code, requested URL) and
+// title and detail of a problem, if response contained problem details.
 func (e *HTTPError) Error() string {
-	return fmt.Sprintf("HTTPError: %s - %s (%s)", e.Method, e.RequestURL, e.Name)
+	msg := fmt.Sprintf("HTTPError: %s - %s (%s)", e.Method, e.RequestURL, e.Name)
+	if e.Problem == nil {
+		return msg
+	}
+	var parts []string
+	for _, part := range []string{e.Problem.Title, e.Problem.Detail} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) == 0 {
+		return msg
+	}
+	return msg + ": " + strings.Join(parts, ": ")
 }
 
 func createError(resp *http.Response) error {
 	if resp.StatusCode < 400 {
 		return nil
 	}
+	return newHTTPError(resp, 0)
+}
+
+// newHTTPError creates HTTPError from provided response. If maxBody is
+// positive, at most maxBody bytes of response body are read.
+func newHTTPError(resp *http.Response, maxBody int64) *HTTPError {
 	var rawData []byte
 	if resp.Body != nil {
-		rawData, _ = ioutil.ReadAll(resp.Body)
+		var body io.Reader = resp.Body
+		if maxBody > 0 {
+			body = io.LimitReader(body, maxBody)
+		}
+		rawData, _ = ioutil.ReadAll(body)
 		defer resp.Body.Close()
 	}
+	return httpErrorWithBody(resp, rawData)
+}
 
+// httpErrorWithBody creates HTTPError from provided response and its
+// already read body.
+func httpErrorWithBody(resp *http.Response, rawData []byte) *HTTPError {
 	return &HTTPError{
 		Name:       resp.Status,
 		StatusCode: resp.StatusCode,
 		RequestURL: resp.Request.URL.String(),
 		Method:     resp.Request.Method,
 		Body:       rawData,
+		Problem:    ParseProblem(resp.Header.Get("Content-Type"), rawData),
 	}
 }
 
@@ -0,0 +1,203 @@
+package errors
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+
+	c "github.com/delicb/kioto/cliware"
+	"github.com/delicb/kioto/middlewares/responsebody"
+	"github.com/delicb/kioto/middlewares/retry"
+)
+
+// LogicalCheck inspects successful response and its body and reports if
+// response actually represents failure, together with message describing it.
+type LogicalCheck func(resp *http.Response, body []byte) (failed bool, message string)
+
+// LogicalError is error for responses that have successful status code, but
+// their body indicates failure. It wraps HTTPError, so it can be handled
+// same way as responses with error status codes.
+type LogicalError struct {
+	*HTTPError
+	Message string
+}
+
+// Error is implementation of error interface.
+func (e *LogicalError) Error() string {
+	if e.Message == "" {
+		return e.HTTPError.Error()
+	}
+	return e.HTTPError.Error() + ": " + e.Message
+}
+
+// Unwrap returns underlying HTTPError.
+func (e *LogicalError) Unwrap() error {
+	return e.HTTPError
+}
+
+// Logical converts successful (2xx) responses for which provided check
+// reports failure to LogicalError. Response body is buffered, so it can still
+// be read by other middlewares and by caller. If body is already replayable
+// (see responsebody.Replayable), its buffer is used. Check sees at most
+// DefaultMaxBody bytes of body, rest of it is not buffered.
+func Logical(check LogicalCheck) c.Middleware {
+	return c.ResponseProcessor(func(resp *http.Response, err error) error {
+		if err != nil {
+			return err
+		}
+		failed, message, body, err := runCheck(check, resp)
+		if err != nil {
+			return err
+		}
+		if !failed {
+			return nil
+		}
+		return &LogicalError{
+			HTTPError: httpErrorWithBody(resp, body),
+			Message:   message,
+		}
+	})
+}
+
+// LogicalClassifier returns retry classifier that indicates that request
+// should be repeated if provided check reports failure. It can be combined
+// with other classifiers using retry.OrClassifier.
+func LogicalClassifier(check LogicalCheck) retry.Classifier {
+	return func(resp *http.Response, err error) bool {
+		if err != nil || resp == nil {
+			return false
+		}
+		failed, _, _, err := runCheck(check, resp)
+		return err == nil && failed
+	}
+}
+
+// runCheck executes check on successful responses, after body is buffered.
+func runCheck(check LogicalCheck, resp *http.Response) (bool, string, []byte, error) {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return false, "", nil, nil
+	}
+	body, err := bufferBody(resp)
+	if err != nil {
+		return false, "", nil, err
+	}
+	failed, message := check(resp, body)
+	return failed, message, body, nil
+}
+
+// bufferBody reads response body, up to DefaultMaxBody bytes, and makes sure
+// that whole body can still be read. For longer bodies only beginning is
+// returned, which is usually enough to detect failure.
+func bufferBody(resp *http.Response) ([]byte, error) {
+	if resp.Body == nil {
+		return nil, nil
+	}
+	if body, ok := resp.Body.(*responsebody.ReplayableBody); ok {
+		if body.Len() <= DefaultMaxBody {
+			return body.Bytes()
+		}
+		data, err := ioutil.ReadAll(io.LimitReader(body, DefaultMaxBody))
+		if rewindErr := body.Rewind(); err == nil {
+			err = rewindErr
+		}
+		return data, err
+	}
+	// one byte more than limit is read to tell if there is more of the body
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, DefaultMaxBody+1))
+	if err != nil {
+		_ = resp.Body.Close()
+		return nil, err
+	}
+	if len(data) > DefaultMaxBody {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(data), resp.Body), resp.Body}
+		return data[:DefaultMaxBody], nil
+	}
+	closeErr := resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+	return data, closeErr
+}
+
+// JSONField returns check that reports failure if JSON body contains field
+// on dot separated path with provided value. E.g. JSONField("ok", false)
+// detects failures of APIs that respond with {"ok": false}.
+func JSONField(path string, failValue interface{}) LogicalCheck {
+	expected := normalizeJSON(failValue)
+	return func(resp *http.Response, body []byte) (bool, string) {
+		value, ok := jsonLookup(body, path)
+		if !ok || !reflect.DeepEqual(value, expected) {
+			return false, ""
+		}
+		return true, fmt.Sprintf("%s is %v", path, failValue)
+	}
+}
+
+// JSONFieldPresent returns check that reports failure if JSON body contains
+// non empty field on dot separated path. E.g. JSONFieldPresent("errors")
+// detects GraphQL errors. Message contains JSON of found value.
+func JSONFieldPresent(path string) LogicalCheck {
+	return func(resp *http.Response, body []byte) (bool, string) {
+		value, ok := jsonLookup(body, path)
+		if !ok || isEmptyJSON(value) {
+			return false, ""
+		}
+		message, _ := json.Marshal(value)
+		return true, fmt.Sprintf("%s: %s", path, message)
+	}
+}
+
+// jsonLookup returns value on dot separated path in JSON document.
+func jsonLookup(body []byte, path string) (interface{}, bool) {
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, false
+	}
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := data.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		data, ok = obj[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return data, true
+}
+
+// normalizeJSON converts value to the form it would have after JSON
+// decoding to interface{}, so that it can be compared with decoded values.
+func normalizeJSON(value interface{}) interface{} {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return value
+	}
+	return normalized
+}
+
+func isEmptyJSON(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case bool:
+		return !v
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
+}
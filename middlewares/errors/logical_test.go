@@ -0,0 +1,115 @@
+package errors_test
+
+import (
+	sterrors "errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/delicb/kioto/cliware"
+	"github.com/delicb/kioto/middlewares/errors"
+	"github.com/delicb/kioto/middlewares/responsebody"
+)
+
+func TestLogical(t *testing.T) {
+	for _, data := range []struct {
+		Check    errors.LogicalCheck
+		Code     int
+		Body     string
+		Expected string
+	}{
+		{errors.JSONField("ok", false), 200, `{"ok": false, "error": "invalid_auth"}`, "ok is false"},
+		{errors.JSONField("ok", false), 200, `{"ok": true}`, ""},
+		{errors.JSONField("ok", false), 200, `not json`, ""},
+		{errors.JSONField("meta.code", 17), 200, `{"meta": {"code": 17}}`, "meta.code is 17"},
+		{errors.JSONFieldPresent("errors"), 200, `{"data": null, "errors": [{"message": "boom"}]}`, `errors: [{"message":"boom"}]`},
+		{errors.JSONFieldPresent("errors"), 200, `{"data": {}, "errors": []}`, ""},
+		{errors.JSONFieldPresent("errors"), 200, `{"data": {}}`, ""},
+		{errors.JSONField("ok", false), 400, `{"ok": false}`, ""},
+	} {
+		resp := response(data.Code, "application/json", data.Body)
+		_, err := errors.Logical(data.Check).Exec(createHandler(resp, nil)).Handle(cliware.EmptyRequest())
+		if data.Expected == "" {
+			assert.NoError(t, err, data.Body)
+		} else {
+			var logicalErr *errors.LogicalError
+			require.True(t, sterrors.As(err, &logicalErr), "wrong error: %v", err)
+			assert.Equal(t, data.Expected, logicalErr.Message)
+			assert.True(t, strings.HasSuffix(err.Error(), data.Expected), err.Error())
+
+			var httpErr *errors.HTTPError
+			require.True(t, sterrors.As(err, &httpErr), "HTTPError not found in chain")
+			assert.Equal(t, data.Code, httpErr.StatusCode)
+			assert.Equal(t, []byte(data.Body), httpErr.Body)
+		}
+
+		// body can still be read
+		body, readErr := ioutil.ReadAll(resp.Body)
+		require.NoError(t, readErr)
+		assert.Equal(t, data.Body, string(body))
+	}
+}
+
+func TestLogicalCustomCheck(t *testing.T) {
+	check := func(resp *http.Response, body []byte) (bool, string) {
+		return resp.Header.Get("X-Status") == "failed", "failed by header"
+	}
+	resp := response(200, "", "")
+	resp.Header.Set("X-Status", "failed")
+	_, err := errors.Logical(check).Exec(createHandler(resp, nil)).Handle(cliware.EmptyRequest())
+	var logicalErr *errors.LogicalError
+	require.True(t, sterrors.As(err, &logicalErr), "wrong error: %v", err)
+	assert.Equal(t, "failed by header", logicalErr.Message)
+}
+
+func TestLogicalReplayable(t *testing.T) {
+	resp := response(200, "application/json", `{"ok": false}`)
+	chain := cliware.NewChain(errors.Logical(errors.JSONField("ok", false)), responsebody.Replayable(0))
+	_, err := chain.Exec(createHandler(resp, nil)).Handle(cliware.EmptyRequest())
+	assert.Error(t, err)
+	_, ok := resp.Body.(*responsebody.ReplayableBody)
+	assert.True(t, ok, "replayable body replaced")
+}
+
+func TestLogicalMaxBody(t *testing.T) {
+	content := strings.Repeat("a", errors.DefaultMaxBody+1000)
+	var seen int
+	check := func(resp *http.Response, body []byte) (bool, string) {
+		seen = len(body)
+		return false, ""
+	}
+
+	resp := response(200, "text/plain", content)
+	_, err := errors.Logical(check).Exec(createHandler(resp, nil)).Handle(cliware.EmptyRequest())
+	require.NoError(t, err)
+	assert.Equal(t, errors.DefaultMaxBody, seen)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, len(content), len(body), "whole body can still be read")
+
+	resp = response(200, "text/plain", content)
+	chain := cliware.NewChain(errors.Logical(check), responsebody.Replayable(0))
+	_, err = chain.Exec(createHandler(resp, nil)).Handle(cliware.EmptyRequest())
+	require.NoError(t, err)
+	assert.Equal(t, errors.DefaultMaxBody, seen)
+	body, err = ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, len(content), len(body), "whole replayable body can still be read")
+	require.NoError(t, resp.Body.(*responsebody.ReplayableBody).Release())
+}
+
+func TestLogicalClassifier(t *testing.T) {
+	classifier := errors.LogicalClassifier(errors.JSONField("ok", false))
+	resp := response(200, "application/json", `{"ok": false}`)
+	assert.True(t, classifier(resp, nil))
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, `{"ok": false}`, string(body))
+
+	assert.False(t, classifier(response(200, "application/json", `{"ok": true}`), nil))
+	assert.False(t, classifier(nil, sterrors.New("some error")))
+}
@@ -0,0 +1,141 @@
+package errors
+
+import (
+	"bytes"
+	"net/http"
+
+	c "github.com/delicb/kioto/cliware"
+	"github.com/delicb/kioto/codec"
+)
+
+// DefaultMaxBody is maximal number of bytes of error response body that
+// Mapper reads, if not configured otherwise. It also limits part of body
+// that is passed to LogicalCheck.
+const DefaultMaxBody = 1 << 20
+
+// Constructor creates custom error from HTTPError. Returned error should
+// wrap provided HTTPError (e.g. by embedding it and implementing Unwrap
+// method), so that errors.As can find it. If Constructor returns nil,
+// response is not treated as error, but its body is already consumed and
+// available only in HTTPError.
+type Constructor func(httpErr *HTTPError) error
+
+type statusRange struct {
+	from, to int
+	ctor     Constructor
+}
+
+// Mapper is middleware that converts HTTP status codes that represent errors
+// (400 and above) to errors created by registered constructors. For status
+// codes without constructor, HTTPError is returned, same as with Errors
+// middleware. Response body can be decoded to registered type per status
+// code, which is then available as HTTPError.Payload.
+//
+// Usage:
+//
+//	mapper := errors.NewMapper().
+//		On(http.StatusNotFound, func(e *errors.HTTPError) error { return &NotFoundError{e} }).
+//		OnRange(500, 599, func(e *errors.HTTPError) error { return &ServerError{e} }).
+//		DecodeBody(http.StatusBadRequest, func() interface{} { return new(ValidationErrors) })
+//	client.Use(mapper)
+type Mapper struct {
+	exact   map[int]Constructor
+	ranges  []statusRange
+	bodies  map[int]func() interface{}
+	maxBody int64
+	codecs  *codec.Registry
+}
+
+// NewMapper creates Mapper without any registered constructors.
+func NewMapper() *Mapper {
+	return &Mapper{
+		exact:   make(map[int]Constructor),
+		bodies:  make(map[int]func() interface{}),
+		maxBody: DefaultMaxBody,
+		codecs:  codec.Default,
+	}
+}
+
+// On registers constructor for provided status code. Constructors for exact
+// status codes take precedence over ones registered for ranges.
+func (m *Mapper) On(code int, ctor Constructor) *Mapper {
+	m.exact[code] = ctor
+	return m
+}
+
+// OnRange registers constructor for all status codes in provided range,
+// inclusive. If ranges overlap, first registered one is used.
+func (m *Mapper) OnRange(from, to int, ctor Constructor) *Mapper {
+	m.ranges = append(m.ranges, statusRange{from: from, to: to, ctor: ctor})
+	return m
+}
+
+// DecodeBody registers function that creates value into which response body
+// with provided status code is decoded. Codec is selected by response
+// Content-Type (JSON is used if it is missing). Decoded value is set as
+// HTTPError.Payload. If decoding fails, Payload stays nil and raw body is
+// still available.
+func (m *Mapper) DecodeBody(code int, newBody func() interface{}) *Mapper {
+	m.bodies[code] = newBody
+	return m
+}
+
+// MaxBody sets maximal number of bytes of response body that are read.
+// Default is DefaultMaxBody. Zero or negative value means no limit.
+func (m *Mapper) MaxBody(n int64) *Mapper {
+	m.maxBody = n
+	return m
+}
+
+// Codecs sets registry used for decoding response bodies. Default is
+// codec.Default.
+func (m *Mapper) Codecs(registry *codec.Registry) *Mapper {
+	m.codecs = registry
+	return m
+}
+
+// Exec is implementation of cliware.Middleware interface.
+func (m *Mapper) Exec(next c.Handler) c.Handler {
+	return c.ResponseProcessor(func(resp *http.Response, err error) error {
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode < 400 {
+			return nil
+		}
+		httpErr := newHTTPError(resp, m.maxBody)
+		if newBody, ok := m.bodies[resp.StatusCode]; ok {
+			httpErr.Payload = m.decode(resp.Header.Get("Content-Type"), httpErr.Body, newBody())
+		}
+		if ctor := m.constructor(resp.StatusCode); ctor != nil {
+			return ctor(httpErr)
+		}
+		return httpErr
+	}).Exec(next)
+}
+
+func (m *Mapper) constructor(code int) Constructor {
+	if ctor, ok := m.exact[code]; ok {
+		return ctor
+	}
+	for _, r := range m.ranges {
+		if code >= r.from && code <= r.to {
+			return r.ctor
+		}
+	}
+	return nil
+}
+
+func (m *Mapper) decode(contentType string, body []byte, v interface{}) interface{} {
+	if contentType == "" {
+		contentType = codec.JSON.ContentType()
+	}
+	dec, err := m.codecs.Lookup(contentType)
+	if err != nil {
+		return nil
+	}
+	if err := dec.Decode(bytes.NewReader(body), v); err != nil {
+		return nil
+	}
+	return v
+}
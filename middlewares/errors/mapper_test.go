@@ -0,0 +1,123 @@
+package errors_test
+
+import (
+	"bytes"
+	sterrors "errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/delicb/kioto/cliware"
+	"github.com/delicb/kioto/middlewares/errors"
+)
+
+type NotFoundError struct {
+	*errors.HTTPError
+}
+
+func (e *NotFoundError) Unwrap() error { return e.HTTPError }
+
+type ServerError struct {
+	*errors.HTTPError
+}
+
+func (e *ServerError) Unwrap() error { return e.HTTPError }
+
+type validationErrors struct {
+	Fields []string `json:"fields"`
+}
+
+func response(code int, contentType, body string) *http.Response {
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	return &http.Response{
+		StatusCode: code,
+		Status:     http.StatusText(code),
+		Header:     header,
+		Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+		Request: &http.Request{
+			Method: "GET",
+			URL:    &url.URL{Scheme: "http", Host: "example.com"},
+		},
+	}
+}
+
+func newMapper() *errors.Mapper {
+	return errors.NewMapper().
+		On(http.StatusNotFound, func(e *errors.HTTPError) error { return &NotFoundError{e} }).
+		On(http.StatusGone, func(e *errors.HTTPError) error { return nil }).
+		OnRange(500, 599, func(e *errors.HTTPError) error { return &ServerError{e} }).
+		On(http.StatusServiceUnavailable, func(e *errors.HTTPError) error { return e }).
+		DecodeBody(http.StatusBadRequest, func() interface{} { return new(validationErrors) })
+}
+
+func TestMapper(t *testing.T) {
+	mapper := newMapper()
+	handle := func(resp *http.Response) error {
+		_, err := mapper.Exec(createHandler(resp, nil)).Handle(cliware.EmptyRequest())
+		return err
+	}
+
+	assert.NoError(t, handle(response(200, "", "")))
+	assert.NoError(t, handle(response(410, "", "")), "nil from constructor")
+
+	err := handle(response(404, "", "missing"))
+	var notFound *NotFoundError
+	require.True(t, sterrors.As(err, &notFound), "wrong error: %T", err)
+	assert.Equal(t, []byte("missing"), notFound.Body)
+	var httpErr *errors.HTTPError
+	require.True(t, sterrors.As(err, &httpErr), "HTTPError not found in chain")
+	assert.Equal(t, 404, httpErr.StatusCode)
+
+	err = handle(response(502, "", ""))
+	var serverErr *ServerError
+	assert.True(t, sterrors.As(err, &serverErr), "wrong error: %T", err)
+
+	err = handle(response(503, "", ""))
+	_, ok := err.(*errors.HTTPError)
+	assert.True(t, ok, "exact status code does not take precedence over range: %T", err)
+
+	err = handle(response(401, "", ""))
+	_, ok = err.(*errors.HTTPError)
+	assert.True(t, ok, "wrong default error: %T", err)
+}
+
+func TestMapperDecodeBody(t *testing.T) {
+	mapper := newMapper()
+	for _, contentType := range []string{"", "application/json", "application/vnd.error+json"} {
+		resp := response(400, contentType, `{"fields": ["name", "email"]}`)
+		_, err := mapper.Exec(createHandler(resp, nil)).Handle(cliware.EmptyRequest())
+		httpErr, ok := err.(*errors.HTTPError)
+		require.True(t, ok, "wrong error: %T", err)
+		require.IsType(t, &validationErrors{}, httpErr.Payload, contentType)
+		assert.Equal(t, []string{"name", "email"}, httpErr.Payload.(*validationErrors).Fields)
+	}
+
+	resp := response(400, "application/json", `{"fields": `)
+	_, err := mapper.Exec(createHandler(resp, nil)).Handle(cliware.EmptyRequest())
+	httpErr, ok := err.(*errors.HTTPError)
+	require.True(t, ok, "wrong error: %T", err)
+	assert.Nil(t, httpErr.Payload, "payload set for invalid body")
+	assert.Equal(t, []byte(`{"fields": `), httpErr.Body)
+}
+
+func TestMapperMaxBody(t *testing.T) {
+	resp := response(500, "", strings.Repeat("x", 100))
+	_, err := errors.NewMapper().MaxBody(10).Exec(createHandler(resp, nil)).Handle(cliware.EmptyRequest())
+	httpErr, ok := err.(*errors.HTTPError)
+	require.True(t, ok, "wrong error: %T", err)
+	assert.Len(t, httpErr.Body, 10)
+}
+
+func TestMapperOriginalError(t *testing.T) {
+	original := sterrors.New("original")
+	_, err := newMapper().Exec(createHandler(nil, original)).Handle(cliware.EmptyRequest())
+	assert.Equal(t, original, err)
+}
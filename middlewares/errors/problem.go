@@ -0,0 +1,177 @@
+package errors
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// ProblemDetails holds problem details of failed HTTP request, as defined
+// by RFC 7807. Members not defined by RFC are available in Extensions.
+type ProblemDetails struct {
+	Type       string
+	Title      string
+	Status     int
+	Detail     string
+	Instance   string
+	Extensions map[string]interface{}
+}
+
+// ParseProblem parses problem details from response body with provided
+// content type. Media types application/problem+json and
+// application/problem+xml are supported. For any other content type, or if
+// body can not be parsed, nil is returned.
+func ParseProblem(contentType string, body []byte) *ProblemDetails {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+	switch mediaType {
+	case "application/problem+json":
+		return parseProblemJSON(body)
+	case "application/problem+xml":
+		return parseProblemXML(body)
+	}
+	return nil
+}
+
+func parseProblemJSON(body []byte) *ProblemDetails {
+	members := make(map[string]interface{})
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&members); err != nil {
+		return nil
+	}
+
+	problem := &ProblemDetails{}
+	for name, value := range members {
+		s, isString := value.(string)
+		switch {
+		case name == "type" && isString:
+			problem.Type = s
+		case name == "title" && isString:
+			problem.Title = s
+		case name == "detail" && isString:
+			problem.Detail = s
+		case name == "instance" && isString:
+			problem.Instance = s
+		case name == "status" && isStatus(value):
+			status, _ := value.(json.Number).Int64()
+			problem.Status = int(status)
+		default:
+			problem.addExtension(name, value)
+		}
+	}
+	return problem
+}
+
+func isStatus(value interface{}) bool {
+	n, ok := value.(json.Number)
+	if !ok {
+		return false
+	}
+	_, err := n.Int64()
+	return err == nil
+}
+
+// parseProblemXML parses problem details in XML format, as defined in
+// appendix A of RFC 7807. Extension members are parsed as strings, or as
+// slices if they contain child elements.
+func parseProblemXML(body []byte) *ProblemDetails {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	if !nextStart(decoder) {
+		return nil
+	}
+
+	problem := &ProblemDetails{}
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			if err == io.EOF {
+				return problem
+			}
+			return nil
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			value, err := xmlValue(decoder)
+			if err != nil {
+				return nil
+			}
+			s, isString := value.(string)
+			switch {
+			case t.Name.Local == "type" && isString:
+				problem.Type = s
+			case t.Name.Local == "title" && isString:
+				problem.Title = s
+			case t.Name.Local == "detail" && isString:
+				problem.Detail = s
+			case t.Name.Local == "instance" && isString:
+				problem.Instance = s
+			case t.Name.Local == "status" && isString:
+				if status, err := strconv.Atoi(s); err == nil {
+					problem.Status = status
+					continue
+				}
+				problem.addExtension(t.Name.Local, value)
+			default:
+				problem.addExtension(t.Name.Local, value)
+			}
+		case xml.EndElement:
+			// end of root element
+			return problem
+		}
+	}
+}
+
+// nextStart moves decoder after first start element.
+func nextStart(decoder *xml.Decoder) bool {
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			return false
+		}
+		if _, ok := tok.(xml.StartElement); ok {
+			return true
+		}
+	}
+}
+
+// xmlValue reads content of current element, until its end. Content is
+// returned as string, or as slice of child element values if there are any.
+func xmlValue(decoder *xml.Decoder) (interface{}, error) {
+	var text strings.Builder
+	var children []interface{}
+	for {
+		tok, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.CharData:
+			text.Write(t)
+		case xml.StartElement:
+			child, err := xmlValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			children = append(children, child)
+		case xml.EndElement:
+			if children != nil {
+				return children, nil
+			}
+			return strings.TrimSpace(text.String()), nil
+		}
+	}
+}
+
+func (p *ProblemDetails) addExtension(name string, value interface{}) {
+	if p.Extensions == nil {
+		p.Extensions = make(map[string]interface{})
+	}
+	p.Extensions[name] = value
+}
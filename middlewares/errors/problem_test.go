@@ -0,0 +1,100 @@
+package errors_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/delicb/kioto/cliware"
+	"github.com/delicb/kioto/middlewares/errors"
+)
+
+func TestParseProblemJSON(t *testing.T) {
+	body := []byte(`{
+		"type": "https://example.com/probs/out-of-credit",
+		"title": "You do not have enough credit.",
+		"status": 403,
+		"detail": "Your current balance is 30, but that costs 50.",
+		"instance": "/account/12345/msgs/abc",
+		"balance": 30,
+		"accounts": ["/account/12345", "/account/67890"]
+	}`)
+	problem := errors.ParseProblem("application/problem+json; charset=utf-8", body)
+	require.NotNil(t, problem)
+	assert.Equal(t, "https://example.com/probs/out-of-credit", problem.Type)
+	assert.Equal(t, "You do not have enough credit.", problem.Title)
+	assert.Equal(t, 403, problem.Status)
+	assert.Equal(t, "Your current balance is 30, but that costs 50.", problem.Detail)
+	assert.Equal(t, "/account/12345/msgs/abc", problem.Instance)
+	assert.Equal(t, map[string]interface{}{
+		"balance":  json.Number("30"),
+		"accounts": []interface{}{"/account/12345", "/account/67890"},
+	}, problem.Extensions)
+}
+
+func TestParseProblemXML(t *testing.T) {
+	body := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+		<problem xmlns="urn:ietf:rfc:7807">
+			<type>https://example.com/probs/out-of-credit</type>
+			<title>You do not have enough credit.</title>
+			<status>403</status>
+			<detail>Your current balance is 30, but that costs 50.</detail>
+			<instance>/account/12345/msgs/abc</instance>
+			<balance>30</balance>
+			<accounts>
+				<i>/account/12345</i>
+				<i>/account/67890</i>
+			</accounts>
+		</problem>`)
+	problem := errors.ParseProblem("application/problem+xml", body)
+	require.NotNil(t, problem)
+	assert.Equal(t, "https://example.com/probs/out-of-credit", problem.Type)
+	assert.Equal(t, "You do not have enough credit.", problem.Title)
+	assert.Equal(t, 403, problem.Status)
+	assert.Equal(t, "Your current balance is 30, but that costs 50.", problem.Detail)
+	assert.Equal(t, "/account/12345/msgs/abc", problem.Instance)
+	assert.Equal(t, map[string]interface{}{
+		"balance":  "30",
+		"accounts": []interface{}{"/account/12345", "/account/67890"},
+	}, problem.Extensions)
+}
+
+func TestParseProblemInvalid(t *testing.T) {
+	for _, data := range []struct {
+		ContentType string
+		Body        string
+	}{
+		{"application/json", `{"title": "foo"}`},
+		{"application/problem+json", `{"title": `},
+		{"application/problem+json", `[]`},
+		{"application/problem+xml", `<problem><title>foo</problem>`},
+		{"", ""},
+	} {
+		assert.Nil(t, errors.ParseProblem(data.ContentType, []byte(data.Body)), data)
+	}
+}
+
+func TestErrorsProblem(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: 404,
+		Status:     "404 Not Found",
+		Header:     http.Header{"Content-Type": {"application/problem+json"}},
+		Body:       ioutil.NopCloser(bytes.NewBufferString(`{"title": "Not found", "detail": "User 42 does not exist", "status": 404}`)),
+		Request: &http.Request{
+			Method: "GET",
+			URL:    &url.URL{Scheme: "http", Host: "example.com", Path: "/users/42"},
+		},
+	}
+	_, err := errors.Errors().Exec(createHandler(resp, nil)).Handle(cliware.EmptyRequest())
+	httpErr, ok := err.(*errors.HTTPError)
+	require.True(t, ok, "wrong error type: %T", err)
+	require.NotNil(t, httpErr.Problem)
+	assert.Equal(t, 404, httpErr.Problem.Status)
+	assert.Equal(t, "HTTPError: GET - http://example.com/users/42 (404 Not Found): Not found: User 42 does not exist", err.Error())
+}
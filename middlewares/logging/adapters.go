@@ -0,0 +1,84 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+)
+
+// Slog returns Logger that writes entries to provided slog.Logger. Entries
+// for failed requests and responses with status 500 and above are logged
+// with error level, 4xx responses with warning level and everything else
+// with info level.
+func Slog(logger *slog.Logger) Logger {
+	return LoggerFunc(func(ctx context.Context, entry *Entry) {
+		attrs := []slog.Attr{
+			slog.String("method", entry.Method),
+			slog.String("url", entry.URL),
+			slog.Int("status", entry.Status),
+			slog.Duration("duration", entry.Duration),
+			slog.Int("attempts", entry.Attempts),
+			slog.Int64("request_size", entry.RequestSize),
+			slog.Int64("response_size", entry.ResponseSize),
+		}
+		if entry.RequestHeader != nil {
+			attrs = append(attrs, slog.Any("request_header", entry.RequestHeader))
+		}
+		if entry.ResponseHeader != nil {
+			attrs = append(attrs, slog.Any("response_header", entry.ResponseHeader))
+		}
+		if entry.RequestBody != "" {
+			attrs = append(attrs, slog.String("request_body", entry.RequestBody))
+		}
+		if entry.ResponseBody != "" {
+			attrs = append(attrs, slog.String("response_body", entry.ResponseBody))
+		}
+		if entry.Err != nil {
+			attrs = append(attrs, slog.String("error", entry.Err.Error()))
+		}
+		logger.LogAttrs(ctx, level(entry), "http request", attrs...)
+	})
+}
+
+func level(entry *Entry) slog.Level {
+	switch {
+	case entry.Err != nil || entry.Status >= http.StatusInternalServerError:
+		return slog.LevelError
+	case entry.Status >= http.StatusBadRequest:
+		return slog.LevelWarn
+	}
+	return slog.LevelInfo
+}
+
+// Writer returns Logger that writes one line per entry to provided writer.
+// Writes are serialized, so same writer can be shared by concurrent requests.
+func Writer(w io.Writer) Logger {
+	var mu sync.Mutex
+	return LoggerFunc(func(ctx context.Context, entry *Entry) {
+		line := fmt.Sprintf("%s %s status=%d duration=%s attempts=%d request_size=%d response_size=%d",
+			entry.Method, entry.URL, entry.Status, entry.Duration, entry.Attempts,
+			entry.RequestSize, entry.ResponseSize)
+		if entry.RequestHeader != nil {
+			line += fmt.Sprintf(" request_header=%v", entry.RequestHeader)
+		}
+		if entry.ResponseHeader != nil {
+			line += fmt.Sprintf(" response_header=%v", entry.ResponseHeader)
+		}
+		if entry.RequestBody != "" {
+			line += fmt.Sprintf(" request_body=%q", entry.RequestBody)
+		}
+		if entry.ResponseBody != "" {
+			line += fmt.Sprintf(" response_body=%q", entry.ResponseBody)
+		}
+		if entry.Err != nil {
+			line += fmt.Sprintf(" error=%q", entry.Err.Error())
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintln(w, line)
+	})
+}
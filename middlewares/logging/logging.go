@@ -0,0 +1,362 @@
+// Package logging contains middleware for structured logging of HTTP requests
+// with redaction of sensitive data.
+//
+// For every request, method, URL, status code, duration, number of attempts
+// (including retries) and body sizes are passed to Logger. Authorization
+// headers and cookies are always redacted, additional headers, query
+// parameters and JSON body fields can be configured with options.
+//
+// Middleware should be executed after all middlewares that build the request
+// and before response processors that consume response body, so it should be
+// added as post middleware:
+//
+//	client := kioto.New(kioto.PostMiddlewares(logging.New(logging.Slog(slog.Default()))))
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	c "github.com/delicb/kioto/cliware"
+	"github.com/delicb/kioto/middlewares/responsebody"
+	"github.com/delicb/kioto/middlewares/retry"
+)
+
+// Redacted is value that replaces sensitive data in log entries.
+const Redacted = "[REDACTED]"
+
+// defaultRedactedHeaders are headers that are redacted regardless of options.
+var defaultRedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// Entry holds information about one request.
+type Entry struct {
+	Method   string
+	URL      string
+	Status   int
+	Duration time.Duration
+	// Attempts is number of times request was sent, including retries.
+	Attempts int
+	// RequestSize and ResponseSize are body sizes from Content-Length,
+	// -1 if unknown.
+	RequestSize  int64
+	ResponseSize int64
+	// Headers are set only if LogHeaders option is used.
+	RequestHeader  http.Header
+	ResponseHeader http.Header
+	// Bodies are set only if LogBodies option is used.
+	RequestBody  string
+	ResponseBody string
+	// Err is error returned for request. URL in *url.Error is redacted the
+	// same way as URL field.
+	Err error
+}
+
+// Logger receives log entries.
+type Logger interface {
+	Log(ctx context.Context, entry *Entry)
+}
+
+// LoggerFunc is function variant of Logger interface.
+type LoggerFunc func(ctx context.Context, entry *Entry)
+
+// Log is implementation of Logger interface.
+func (f LoggerFunc) Log(ctx context.Context, entry *Entry) {
+	f(ctx, entry)
+}
+
+// Option configures logging middleware.
+type Option func(*Middleware)
+
+// RedactHeaders adds headers whose values are redacted, on top of
+// Authorization, Proxy-Authorization, Cookie and Set-Cookie.
+func RedactHeaders(names ...string) Option {
+	return func(m *Middleware) {
+		for _, name := range names {
+			m.headers[http.CanonicalHeaderKey(name)] = true
+		}
+	}
+}
+
+// RedactQuery sets query parameters whose values are redacted from URL.
+func RedactQuery(params ...string) Option {
+	return func(m *Middleware) {
+		for _, param := range params {
+			m.query[param] = true
+		}
+	}
+}
+
+// RedactJSONFields sets names of JSON object fields whose values are redacted
+// from logged bodies, at any depth. Names are matched case insensitively.
+func RedactJSONFields(fields ...string) Option {
+	return func(m *Middleware) {
+		for _, field := range fields {
+			m.fields[strings.ToLower(field)] = true
+		}
+	}
+}
+
+// LogHeaders enables logging of (redacted) request and response headers.
+func LogHeaders() Option {
+	return func(m *Middleware) {
+		m.logHeaders = true
+	}
+}
+
+// LogBodies enables logging of request and response bodies, truncated to
+// maxBytes. Bodies are not consumed, so they can still be sent and read.
+// If RedactJSONFields is used, JSON bodies that are truncated (and therefore
+// can not be redacted) are omitted from log.
+func LogBodies(maxBytes int) Option {
+	return func(m *Middleware) {
+		m.maxBody = maxBytes
+	}
+}
+
+// Middleware logs requests to Logger.
+type Middleware struct {
+	logger     Logger
+	headers    map[string]bool
+	query      map[string]bool
+	fields     map[string]bool
+	logHeaders bool
+	maxBody    int
+	now        func() time.Time
+}
+
+// New creates logging middleware that sends entries to provided logger.
+func New(logger Logger, options ...Option) *Middleware {
+	m := &Middleware{
+		logger:  logger,
+		headers: make(map[string]bool),
+		query:   make(map[string]bool),
+		fields:  make(map[string]bool),
+		now:     time.Now,
+	}
+	for _, name := range defaultRedactedHeaders {
+		m.headers[name] = true
+	}
+	for _, opt := range options {
+		opt(m)
+	}
+	return m
+}
+
+// Exec is implementation of cliware.Middleware interface.
+func (m *Middleware) Exec(next c.Handler) c.Handler {
+	return c.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		attempts := 1
+		counted := retry.OnRetry(func(int, *http.Response, error, time.Duration) {
+			attempts++
+		}).Exec(next)
+
+		entry := &Entry{
+			Method:       req.Method,
+			URL:          m.redactURL(req.URL),
+			RequestSize:  req.ContentLength,
+			ResponseSize: -1,
+		}
+		if m.logHeaders {
+			entry.RequestHeader = m.redactHeader(req.Header)
+		}
+		if m.maxBody > 0 {
+			entry.RequestBody = m.requestBody(req)
+		}
+
+		start := m.now()
+		resp, err := counted.Handle(req)
+		entry.Duration = m.now().Sub(start)
+		entry.Attempts = attempts
+		entry.Err = m.redactErr(err)
+
+		if resp != nil {
+			entry.Status = resp.StatusCode
+			entry.ResponseSize = resp.ContentLength
+			if m.logHeaders {
+				entry.ResponseHeader = m.redactHeader(resp.Header)
+			}
+			if m.maxBody > 0 {
+				entry.ResponseBody = m.responseBody(resp)
+			}
+		}
+
+		m.logger.Log(req.Context(), entry)
+		return resp, err
+	})
+}
+
+func (m *Middleware) redactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	redacted := *u
+	if redacted.User != nil {
+		if _, hasPassword := redacted.User.Password(); hasPassword {
+			redacted.User = url.UserPassword(redacted.User.Username(), Redacted)
+		}
+	}
+	if len(m.query) > 0 && redacted.RawQuery != "" {
+		query := redacted.Query()
+		for param := range query {
+			if m.query[param] {
+				query.Set(param, Redacted)
+			}
+		}
+		redacted.RawQuery = query.Encode()
+	}
+	return redacted.String()
+}
+
+// redactErr redacts URL that *url.Error returned by HTTP client includes in
+// its message.
+func (m *Middleware) redactErr(err error) error {
+	urlErr, ok := err.(*url.Error)
+	if !ok {
+		return err
+	}
+	u, parseErr := url.Parse(urlErr.URL)
+	if parseErr != nil {
+		return urlErr.Err
+	}
+	redacted := m.redactURL(u)
+	if redacted == urlErr.URL {
+		return err
+	}
+	return &url.Error{Op: urlErr.Op, URL: redacted, Err: urlErr.Err}
+}
+
+func (m *Middleware) redactHeader(header http.Header) http.Header {
+	redacted := make(http.Header, len(header))
+	for name, values := range header {
+		if m.headers[http.CanonicalHeaderKey(name)] {
+			redacted[name] = []string{Redacted}
+			continue
+		}
+		redacted[name] = append([]string(nil), values...)
+	}
+	return redacted
+}
+
+// requestBody returns beginning of request body, leaving body intact.
+func (m *Middleware) requestBody(req *http.Request) string {
+	if req.Body == nil || req.Body == http.NoBody {
+		return ""
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return ""
+		}
+		defer body.Close()
+		read, _ := readPrefix(body, m.maxBody)
+		return m.truncateBody(read)
+	}
+	read, err := readPrefix(req.Body, m.maxBody)
+	req.Body = restoreBody(read, req.Body, err)
+	return m.truncateBody(read)
+}
+
+// responseBody returns beginning of response body, leaving body intact.
+func (m *Middleware) responseBody(resp *http.Response) string {
+	if resp.Body == nil {
+		return ""
+	}
+	if body, ok := resp.Body.(*responsebody.ReplayableBody); ok {
+		data, err := body.Bytes()
+		if err != nil {
+			return ""
+		}
+		return m.truncateBody(data)
+	}
+	read, err := readPrefix(resp.Body, m.maxBody)
+	resp.Body = restoreBody(read, resp.Body, err)
+	return m.truncateBody(read)
+}
+
+// truncateBody formats body for logging, truncating it to configured size.
+func (m *Middleware) truncateBody(data []byte) string {
+	if len(data) > m.maxBody {
+		return m.formatBody(data[:m.maxBody], true)
+	}
+	return m.formatBody(data, false)
+}
+
+// formatBody redacts and formats body for logging.
+func (m *Middleware) formatBody(data []byte, truncated bool) string {
+	if len(m.fields) > 0 {
+		trimmed := bytes.TrimSpace(data)
+		if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+			if truncated {
+				return "[body omitted, too large to redact]"
+			}
+			var doc interface{}
+			if err := json.Unmarshal(trimmed, &doc); err == nil {
+				if redacted, err := json.Marshal(m.redactJSON(doc)); err == nil {
+					return string(redacted)
+				}
+			}
+		}
+	}
+	if truncated {
+		return string(data) + "...(truncated)"
+	}
+	return string(data)
+}
+
+func (m *Middleware) redactJSON(doc interface{}) interface{} {
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if m.fields[strings.ToLower(key)] {
+				v[key] = Redacted
+			} else {
+				v[key] = m.redactJSON(value)
+			}
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = m.redactJSON(value)
+		}
+	}
+	return doc
+}
+
+// readPrefix reads up to limit+1 bytes from reader, so that caller can
+// determine if there was more data than limit.
+func readPrefix(r io.Reader, limit int) ([]byte, error) {
+	return ioutil.ReadAll(io.LimitReader(r, int64(limit)+1))
+}
+
+// bodyReader is body whose beginning has been read already.
+type bodyReader struct {
+	io.Reader
+	io.Closer
+}
+
+// restoreBody returns body that yields already read prefix followed by rest
+// of original body. Read error, if any, is returned after the prefix.
+func restoreBody(prefix []byte, body io.ReadCloser, err error) io.ReadCloser {
+	rest := io.Reader(body)
+	if err != nil {
+		rest = errReader{err}
+	}
+	return bodyReader{
+		Reader: io.MultiReader(bytes.NewReader(prefix), rest),
+		Closer: body,
+	}
+}
+
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
@@ -0,0 +1,158 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/delicb/kioto"
+	"github.com/delicb/kioto/middlewares/body"
+	"github.com/delicb/kioto/middlewares/headers"
+	"github.com/delicb/kioto/middlewares/logging"
+	"github.com/delicb/kioto/middlewares/retry"
+)
+
+type collector struct {
+	entries []*logging.Entry
+}
+
+func (c *collector) Log(ctx context.Context, entry *logging.Entry) {
+	c.entries = append(c.entries, entry)
+}
+
+func TestLogging(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret"})
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"user": {"name": "john", "password": "hunter2"}}`))
+	}))
+	defer server.Close()
+
+	logs := &collector{}
+	client := kioto.New(kioto.PostMiddlewares(logging.New(logs,
+		logging.LogHeaders(),
+		logging.LogBodies(1024),
+		logging.RedactQuery("api_key"),
+		logging.RedactHeaders("X-Secret"),
+		logging.RedactJSONFields("password", "token"),
+	)))
+
+	resp, err := client.Request().
+		URL(server.URL+"/users?api_key=secret&page=1").
+		Use(
+			headers.Set("Authorization", "Bearer secret"),
+			headers.Set("X-Secret", "secret"),
+			body.JSON(map[string]string{"token": "secret", "name": "john"}),
+			retry.SetClassifier(retry.On500PlusClassifier),
+			retry.Methods("POST"),
+			retry.SetBackoffStrategy(retry.ConstantBackoff(time.Millisecond)),
+		).
+		Send()
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "hunter2", "response body consumed by logging")
+
+	require.Len(t, logs.entries, 1)
+	entry := logs.entries[0]
+	assert.Equal(t, "POST", entry.Method)
+	assert.Equal(t, 200, entry.Status)
+	assert.Equal(t, 2, entry.Attempts)
+	assert.True(t, entry.Duration > 0)
+	assert.NotContains(t, entry.URL, "secret")
+	assert.Contains(t, entry.URL, "page=1")
+	assert.Equal(t, []string{logging.Redacted}, entry.RequestHeader["Authorization"])
+	assert.Equal(t, []string{logging.Redacted}, entry.RequestHeader["X-Secret"])
+	assert.Equal(t, []string{logging.Redacted}, entry.ResponseHeader["Set-Cookie"])
+	assert.Equal(t, `{"name":"john","token":"[REDACTED]"}`, entry.RequestBody)
+	assert.Equal(t, `{"user":{"name":"john","password":"[REDACTED]"}}`, entry.ResponseBody)
+	assert.Equal(t, int64(len(data)), entry.ResponseSize)
+}
+
+func TestLoggingTruncate(t *testing.T) {
+	content := strings.Repeat("x", 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	logs := &collector{}
+	client := kioto.New(kioto.PostMiddlewares(logging.New(logs, logging.LogBodies(10))))
+	resp, err := client.Request().URL(server.URL).Use(body.Reader(strings.NewReader(content))).Send()
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(data))
+
+	require.Len(t, logs.entries, 1)
+	assert.Equal(t, "xxxxxxxxxx...(truncated)", logs.entries[0].RequestBody)
+	assert.Equal(t, "xxxxxxxxxx...(truncated)", logs.entries[0].ResponseBody)
+}
+
+func TestLoggingError(t *testing.T) {
+	logs := &collector{}
+	client := kioto.New(kioto.DisableRetry(), kioto.PostMiddlewares(logging.New(logs)))
+	_, err := client.Request().URL("http://127.0.0.1:1/").Send()
+	require.Error(t, err)
+	require.Len(t, logs.entries, 1)
+	assert.Equal(t, err, logs.entries[0].Err)
+	assert.Equal(t, 1, logs.entries[0].Attempts)
+	assert.Equal(t, 0, logs.entries[0].Status)
+}
+
+func TestLoggingErrorRedacted(t *testing.T) {
+	buff := &bytes.Buffer{}
+	client := kioto.New(kioto.DisableRetry(), kioto.PostMiddlewares(logging.New(logging.Writer(buff),
+		logging.RedactQuery("token"),
+	)))
+	_, err := client.Request().URL("http://127.0.0.1:1/x?token=SECRET").Send()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "SECRET", "returned error is not changed")
+	assert.Contains(t, buff.String(), "error=")
+	assert.NotContains(t, buff.String(), "SECRET")
+}
+
+func TestWriter(t *testing.T) {
+	buff := &bytes.Buffer{}
+	logging.Writer(buff).Log(context.Background(), &logging.Entry{
+		Method:       "GET",
+		URL:          "http://example.com",
+		Status:       200,
+		Duration:     time.Second,
+		Attempts:     1,
+		RequestSize:  0,
+		ResponseSize: 10,
+	})
+	assert.Equal(t, "GET http://example.com status=200 duration=1s attempts=1 request_size=0 response_size=10\n", buff.String())
+}
+
+func TestSlog(t *testing.T) {
+	buff := &bytes.Buffer{}
+	logger := slog.New(slog.NewTextHandler(buff, nil))
+	logging.Slog(logger).Log(context.Background(), &logging.Entry{
+		Method:   "GET",
+		URL:      "http://example.com",
+		Status:   503,
+		Attempts: 3,
+	})
+	out := buff.String()
+	assert.Contains(t, out, "level=ERROR")
+	assert.Contains(t, out, `msg="http request"`)
+	assert.Contains(t, out, "status=503")
+	assert.Contains(t, out, "attempts=3")
+}
@@ -0,0 +1,210 @@
+package metrics
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are upper bounds (in seconds) of request duration histogram
+// buckets used if none are provided to NewExpvarRecorder.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// seriesKey identifies one series of metrics.
+type seriesKey struct {
+	Method      string
+	Host        string
+	Route       string
+	StatusClass string
+	ErrorKind   string
+}
+
+// series holds metrics for one seriesKey.
+type series struct {
+	Count         uint64
+	DurationSum   float64
+	Buckets       []uint64
+	RequestBytes  int64
+	ResponseBytes int64
+}
+
+// ExpvarRecorder is Recorder that keeps request counts, duration histograms
+// and transferred bytes in memory. It implements expvar.Var, so it can be
+// published with expvar, and it can expose metrics in Prometheus text format
+// with Handler.
+type ExpvarRecorder struct {
+	mu      sync.Mutex
+	buckets []float64
+	series  map[seriesKey]*series
+}
+
+// NewExpvarRecorder creates ExpvarRecorder with provided duration histogram
+// buckets (upper bounds in seconds, in increasing order). If no buckets are
+// provided, DefaultBuckets are used. If name is not empty, recorder is
+// published with expvar under that name.
+func NewExpvarRecorder(name string, buckets ...float64) *ExpvarRecorder {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	r := &ExpvarRecorder{
+		buckets: append([]float64(nil), buckets...),
+		series:  make(map[seriesKey]*series),
+	}
+	if name != "" {
+		expvar.Publish(name, r)
+	}
+	return r
+}
+
+// Observe is implementation of Recorder interface.
+func (r *ExpvarRecorder) Observe(o Observation) {
+	key := seriesKey{
+		Method:      o.Method,
+		Host:        o.Host,
+		Route:       o.Route,
+		StatusClass: o.StatusClass,
+		ErrorKind:   o.ErrorKind,
+	}
+	seconds := o.Duration.Seconds()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.series[key]
+	if !ok {
+		s = &series{Buckets: make([]uint64, len(r.buckets))}
+		r.series[key] = s
+	}
+	s.Count++
+	s.DurationSum += seconds
+	for i, bound := range r.buckets {
+		if seconds <= bound {
+			s.Buckets[i]++
+		}
+	}
+	if o.RequestSize > 0 {
+		s.RequestBytes += o.RequestSize
+	}
+	if o.ResponseSize > 0 {
+		s.ResponseBytes += o.ResponseSize
+	}
+}
+
+// String is implementation of expvar.Var interface. It returns all series
+// in JSON format.
+func (r *ExpvarRecorder) String() string {
+	type entry struct {
+		seriesKey
+		series
+	}
+	var entries []entry
+	for _, e := range r.snapshot() {
+		entries = append(entries, entry{e.key, e.series})
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return "null"
+	}
+	return string(data)
+}
+
+type snapshotEntry struct {
+	key    seriesKey
+	series series
+}
+
+// snapshot returns copy of all series, sorted by key.
+func (r *ExpvarRecorder) snapshot() []snapshotEntry {
+	r.mu.Lock()
+	entries := make([]snapshotEntry, 0, len(r.series))
+	for k, s := range r.series {
+		copied := *s
+		copied.Buckets = append([]uint64(nil), s.Buckets...)
+		entries = append(entries, snapshotEntry{key: k, series: copied})
+	}
+	r.mu.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i].key, entries[j].key
+		for _, pair := range [][2]string{
+			{a.Method, b.Method}, {a.Host, b.Host}, {a.Route, b.Route},
+			{a.StatusClass, b.StatusClass}, {a.ErrorKind, b.ErrorKind},
+		} {
+			if pair[0] != pair[1] {
+				return pair[0] < pair[1]
+			}
+		}
+		return false
+	})
+	return entries
+}
+
+// Handler returns http.Handler that exposes metrics in Prometheus text
+// exposition format.
+func (r *ExpvarRecorder) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteTo(w)
+	})
+}
+
+// WriteTo writes metrics to provided writer in Prometheus text exposition
+// format.
+func (r *ExpvarRecorder) WriteTo(w io.Writer) (int64, error) {
+	entries := r.snapshot()
+	b := &strings.Builder{}
+
+	b.WriteString("# HELP kioto_client_requests_total Total number of HTTP client requests.\n")
+	b.WriteString("# TYPE kioto_client_requests_total counter\n")
+	for _, e := range entries {
+		fmt.Fprintf(b, "kioto_client_requests_total{%s} %d\n", labels(e.key), e.series.Count)
+	}
+
+	b.WriteString("# HELP kioto_client_request_duration_seconds Duration of HTTP client requests.\n")
+	b.WriteString("# TYPE kioto_client_request_duration_seconds histogram\n")
+	for _, e := range entries {
+		l := labels(e.key)
+		for i, bound := range r.buckets {
+			fmt.Fprintf(b, "kioto_client_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n",
+				l, formatFloat(bound), e.series.Buckets[i])
+		}
+		fmt.Fprintf(b, "kioto_client_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", l, e.series.Count)
+		fmt.Fprintf(b, "kioto_client_request_duration_seconds_sum{%s} %s\n", l, formatFloat(e.series.DurationSum))
+		fmt.Fprintf(b, "kioto_client_request_duration_seconds_count{%s} %d\n", l, e.series.Count)
+	}
+
+	b.WriteString("# HELP kioto_client_request_size_bytes_total Total size of HTTP client request bodies.\n")
+	b.WriteString("# TYPE kioto_client_request_size_bytes_total counter\n")
+	for _, e := range entries {
+		fmt.Fprintf(b, "kioto_client_request_size_bytes_total{%s} %d\n", labels(e.key), e.series.RequestBytes)
+	}
+
+	b.WriteString("# HELP kioto_client_response_size_bytes_total Total size of HTTP client response bodies.\n")
+	b.WriteString("# TYPE kioto_client_response_size_bytes_total counter\n")
+	for _, e := range entries {
+		fmt.Fprintf(b, "kioto_client_response_size_bytes_total{%s} %d\n", labels(e.key), e.series.ResponseBytes)
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func labels(k seriesKey) string {
+	return fmt.Sprintf(`method="%s",host="%s",route="%s",status_class="%s",error_kind="%s"`,
+		escape(k.Method), escape(k.Host), escape(k.Route), escape(k.StatusClass), escape(k.ErrorKind))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
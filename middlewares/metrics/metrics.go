@@ -0,0 +1,145 @@
+// Package metrics contains middleware that reports request counts, latencies
+// and sizes to Recorder.
+//
+// To keep number of distinct series low, requests are identified by route
+// template (e.g. "/users/:id", see url.Param) instead of full URL. Paths
+// built without url.Param are reported as they are, so identifiers should
+// not be put into path directly. Package
+// provides ExpvarRecorder, which publishes metrics with expvar and exposes
+// them in Prometheus text format, without any third party dependencies.
+package metrics
+
+import (
+	"context"
+	"crypto/x509"
+	sterrors "errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	c "github.com/delicb/kioto/cliware"
+	"github.com/delicb/kioto/middlewares/url"
+)
+
+// Error kinds reported in Observation.ErrorKind.
+const (
+	ErrorKindNone       = ""
+	ErrorKindTimeout    = "timeout"
+	ErrorKindCanceled   = "canceled"
+	ErrorKindDNS        = "dns"
+	ErrorKindConnection = "connection"
+	ErrorKindTLS        = "tls"
+	ErrorKindOther      = "other"
+)
+
+// Observation holds information about one finished request.
+type Observation struct {
+	Method string
+	Host   string
+	// Route is route template of request (see url.RouteTemplate) or request
+	// path if path has no parameters.
+	Route string
+	// StatusClass is class of response status code (e.g. "2xx"), empty if
+	// there was no response.
+	StatusClass string
+	// ErrorKind is one of ErrorKind constants.
+	ErrorKind string
+	Duration  time.Duration
+	// RequestSize and ResponseSize are body sizes from Content-Length,
+	// -1 if unknown.
+	RequestSize  int64
+	ResponseSize int64
+}
+
+// Recorder receives observations of finished requests. Implementations must
+// be safe for concurrent use.
+type Recorder interface {
+	Observe(o Observation)
+}
+
+// RecorderFunc is function variant of Recorder interface.
+type RecorderFunc func(o Observation)
+
+// Observe is implementation of Recorder interface.
+func (f RecorderFunc) Observe(o Observation) {
+	f(o)
+}
+
+// Record reports every request to provided recorder. Middleware needs to be
+// executed after middlewares that build request (e.g. url.Param), so it
+// should be added as post middleware (Client.UsePost).
+func Record(recorder Recorder) c.Middleware {
+	return c.MiddlewareFunc(func(next c.Handler) c.Handler {
+		return c.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.Handle(req)
+
+			o := Observation{
+				Method:       req.Method,
+				Host:         req.URL.Host,
+				Route:        route(req),
+				ErrorKind:    ErrorKind(err),
+				Duration:     time.Since(start),
+				RequestSize:  req.ContentLength,
+				ResponseSize: -1,
+			}
+			if resp != nil {
+				o.StatusClass = StatusClass(resp.StatusCode)
+				o.ResponseSize = resp.ContentLength
+			}
+			recorder.Observe(o)
+			return resp, err
+		})
+	})
+}
+
+// route returns route template of provided request, falling back to its path
+// for requests built without parameters.
+func route(req *http.Request) string {
+	if template := url.RouteTemplate(req.Context()); template != "" {
+		return template
+	}
+	if req.URL.Path == "" {
+		return "/"
+	}
+	return req.URL.Path
+}
+
+// StatusClass returns class of provided status code, e.g. "4xx" for 404.
+func StatusClass(code int) string {
+	if code < 100 || code > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(code/100) + "xx"
+}
+
+// ErrorKind classifies provided error into one of ErrorKind constants.
+func ErrorKind(err error) string {
+	if err == nil {
+		return ErrorKindNone
+	}
+	var (
+		netErr      net.Error
+		dnsErr      *net.DNSError
+		opErr       *net.OpError
+		authErr     x509.UnknownAuthorityError
+		certErr     x509.CertificateInvalidError
+		hostnameErr x509.HostnameError
+	)
+	switch {
+	case sterrors.Is(err, context.Canceled):
+		return ErrorKindCanceled
+	case sterrors.Is(err, context.DeadlineExceeded):
+		return ErrorKindTimeout
+	case sterrors.As(err, &dnsErr):
+		return ErrorKindDNS
+	case sterrors.As(err, &authErr), sterrors.As(err, &certErr), sterrors.As(err, &hostnameErr):
+		return ErrorKindTLS
+	case sterrors.As(err, &netErr) && netErr.Timeout():
+		return ErrorKindTimeout
+	case sterrors.As(err, &opErr):
+		return ErrorKindConnection
+	}
+	return ErrorKindOther
+}
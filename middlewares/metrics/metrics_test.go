@@ -0,0 +1,194 @@
+package metrics_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/delicb/kioto"
+	"github.com/delicb/kioto/middlewares/metrics"
+	"github.com/delicb/kioto/middlewares/url"
+)
+
+type collector struct {
+	mu           sync.Mutex
+	observations []metrics.Observation
+}
+
+func (c *collector) Observe(o metrics.Observation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.observations = append(c.observations, o)
+}
+
+func TestRecord(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/missing") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	rec := &collector{}
+	client := kioto.New(kioto.PostMiddlewares(metrics.Record(rec)))
+	for _, id := range []string{"1", "2", "missing"} {
+		resp, err := client.Request().URL(server.URL + "/users/:id").Use(url.Param("id", id)).Send()
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	require.Len(t, rec.observations, 3)
+	for i, o := range rec.observations {
+		assert.Equal(t, "GET", o.Method)
+		assert.Equal(t, strings.TrimPrefix(server.URL, "http://"), o.Host)
+		assert.Equal(t, "/users/:id", o.Route)
+		assert.Equal(t, metrics.ErrorKindNone, o.ErrorKind)
+		assert.True(t, o.Duration > 0)
+		if i < 2 {
+			assert.Equal(t, "2xx", o.StatusClass)
+			assert.Equal(t, int64(5), o.ResponseSize)
+		} else {
+			assert.Equal(t, "4xx", o.StatusClass)
+		}
+	}
+}
+
+func TestRecordStaticRoutes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	rec := &collector{}
+	client := kioto.New(kioto.PostMiddlewares(metrics.Record(rec)))
+	for _, path := range []string{"/health", "/users", ""} {
+		resp, err := client.Request().URL(server.URL + path).Send()
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	require.Len(t, rec.observations, 3)
+	assert.Equal(t, "/health", rec.observations[0].Route)
+	assert.Equal(t, "/users", rec.observations[1].Route)
+	assert.Equal(t, "/", rec.observations[2].Route)
+}
+
+func TestRecordError(t *testing.T) {
+	rec := &collector{}
+	client := kioto.New(kioto.DisableRetry(), kioto.PostMiddlewares(metrics.Record(rec)))
+	_, err := client.Request().URL("http://127.0.0.1:1/").Send()
+	require.Error(t, err)
+	require.Len(t, rec.observations, 1)
+	assert.Equal(t, "", rec.observations[0].StatusClass)
+	assert.Equal(t, metrics.ErrorKindConnection, rec.observations[0].ErrorKind)
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestErrorKind(t *testing.T) {
+	for _, data := range []struct {
+		err  error
+		kind string
+	}{
+		{nil, metrics.ErrorKindNone},
+		{context.Canceled, metrics.ErrorKindCanceled},
+		{fmt.Errorf("wrapped: %w", context.DeadlineExceeded), metrics.ErrorKindTimeout},
+		{timeoutError{}, metrics.ErrorKindTimeout},
+		{&net.DNSError{Err: "no such host", Name: "example.invalid"}, metrics.ErrorKindDNS},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, metrics.ErrorKindConnection},
+		{errors.New("something"), metrics.ErrorKindOther},
+	} {
+		assert.Equal(t, data.kind, metrics.ErrorKind(data.err), "%v", data.err)
+	}
+}
+
+func TestStatusClass(t *testing.T) {
+	assert.Equal(t, "2xx", metrics.StatusClass(204))
+	assert.Equal(t, "5xx", metrics.StatusClass(503))
+	assert.Equal(t, "unknown", metrics.StatusClass(0))
+}
+
+func TestExpvarRecorder(t *testing.T) {
+	rec := metrics.NewExpvarRecorder("kioto_test_metrics", 0.1, 1)
+	o := metrics.Observation{
+		Method:       "GET",
+		Host:         "example.com",
+		Route:        `/users/"id"`,
+		StatusClass:  "2xx",
+		Duration:     50 * time.Millisecond,
+		RequestSize:  -1,
+		ResponseSize: 10,
+	}
+	rec.Observe(o)
+	o.Duration = 500 * time.Millisecond
+	rec.Observe(o)
+	o.StatusClass = ""
+	o.ErrorKind = metrics.ErrorKindTimeout
+	o.Duration = 2 * time.Second
+	o.ResponseSize = -1
+	rec.Observe(o)
+
+	server := httptest.NewServer(rec.Handler())
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", resp.Header.Get("Content-Type"))
+
+	ok := `method="GET",host="example.com",route="/users/\"id\"",status_class="2xx",error_kind=""`
+	timeout := `method="GET",host="example.com",route="/users/\"id\"",status_class="",error_kind="timeout"`
+	expected := strings.Join([]string{
+		"# HELP kioto_client_requests_total Total number of HTTP client requests.",
+		"# TYPE kioto_client_requests_total counter",
+		"kioto_client_requests_total{" + timeout + "} 1",
+		"kioto_client_requests_total{" + ok + "} 2",
+		"# HELP kioto_client_request_duration_seconds Duration of HTTP client requests.",
+		"# TYPE kioto_client_request_duration_seconds histogram",
+		"kioto_client_request_duration_seconds_bucket{" + timeout + `,le="0.1"} 0`,
+		"kioto_client_request_duration_seconds_bucket{" + timeout + `,le="1"} 0`,
+		"kioto_client_request_duration_seconds_bucket{" + timeout + `,le="+Inf"} 1`,
+		"kioto_client_request_duration_seconds_sum{" + timeout + "} 2",
+		"kioto_client_request_duration_seconds_count{" + timeout + "} 1",
+		"kioto_client_request_duration_seconds_bucket{" + ok + `,le="0.1"} 1`,
+		"kioto_client_request_duration_seconds_bucket{" + ok + `,le="1"} 2`,
+		"kioto_client_request_duration_seconds_bucket{" + ok + `,le="+Inf"} 2`,
+		"kioto_client_request_duration_seconds_sum{" + ok + "} 0.55",
+		"kioto_client_request_duration_seconds_count{" + ok + "} 2",
+		"# HELP kioto_client_request_size_bytes_total Total size of HTTP client request bodies.",
+		"# TYPE kioto_client_request_size_bytes_total counter",
+		"kioto_client_request_size_bytes_total{" + timeout + "} 0",
+		"kioto_client_request_size_bytes_total{" + ok + "} 0",
+		"# HELP kioto_client_response_size_bytes_total Total size of HTTP client response bodies.",
+		"# TYPE kioto_client_response_size_bytes_total counter",
+		"kioto_client_response_size_bytes_total{" + timeout + "} 0",
+		"kioto_client_response_size_bytes_total{" + ok + "} 20",
+	}, "\n") + "\n"
+	assert.Equal(t, expected, string(data))
+
+	published := expvar.Get("kioto_test_metrics")
+	require.NotNil(t, published, "recorder not published")
+	var series []map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(published.String()), &series))
+	require.Len(t, series, 2)
+	assert.Equal(t, float64(2), series[1]["Count"])
+	assert.Equal(t, "2xx", series[1]["StatusClass"])
+}
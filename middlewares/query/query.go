@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	c "github.com/delicb/kioto/cliware"
+	"github.com/delicb/kioto/form"
 )
 
 // Set sets value as query parameter with provided key to URL.
@@ -57,3 +58,22 @@ func SetMap(queryMap map[string]string) c.Middleware {
 		return nil
 	})
 }
+
+// Form sets all query parameters obtained by encoding provided data to URL.
+// Data can be url.Values, map[string]string, map[string][]string or a struct
+// with optional "form" tags (see form package for details). Existing query
+// parameters with same keys are replaced.
+func Form(data interface{}) c.Middleware {
+	return c.RequestProcessor(func(req *http.Request) error {
+		values, err := form.Encode(data)
+		if err != nil {
+			return err
+		}
+		query := req.URL.Query()
+		for k, v := range values {
+			query[k] = v
+		}
+		req.URL.RawQuery = query.Encode()
+		return nil
+	})
+}
@@ -210,6 +210,55 @@ func TestSetMap(t *testing.T) {
 	}
 }
 
+func TestForm(t *testing.T) {
+	type filter struct {
+		Status []string `form:"status"`
+		Limit  int      `form:"limit,omitempty"`
+	}
+	for _, data := range []struct {
+		InitialURL     string
+		Data           interface{}
+		ResultingQuery string
+	}{
+		{
+			InitialURL:     "http://example.com/path",
+			Data:           filter{Status: []string{"open", "closed"}, Limit: 10},
+			ResultingQuery: "status=open&status=closed&limit=10",
+		},
+		{
+			InitialURL:     "http://example.com/path?status=all&page=2",
+			Data:           filter{Status: []string{"open"}},
+			ResultingQuery: "status=open&page=2",
+		},
+		{
+			InitialURL:     "http://example.com/path",
+			Data:           map[string]string{"q": "search"},
+			ResultingQuery: "q=search",
+		},
+	} {
+		m := query.Form(data.Data)
+		req := cliware.EmptyRequest()
+		parsedURL, err := neturl.Parse(data.InitialURL)
+		if err != nil {
+			t.Fatal("Input data not valid. URL parsing failed: ", err)
+		}
+		req.URL = parsedURL
+		handler := createHandler()
+		if _, err := m.Exec(handler).Handle(req); err != nil {
+			t.Error("Unexpected error: ", err)
+		}
+
+		q, err := neturl.ParseQuery(data.ResultingQuery)
+		if err != nil {
+			t.Fatal("Invalid test data, failed to parse query params: ", data.ResultingQuery)
+		}
+
+		if !reflect.DeepEqual(req.URL.Query(), q) {
+			t.Errorf("Wrong query parameters. Got: %s, expected: %s.", req.URL.RawQuery, data.ResultingQuery)
+		}
+	}
+}
+
 func createHandler() cliware.Handler {
 	return cliware.HandlerFunc(func(req *http.Request) (resp *http.Response, err error) {
 		return nil, nil
@@ -0,0 +1,229 @@
+// Package ratelimit contains middleware that limits rate at which requests
+// are sent, globally, per host or per custom key.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	c "github.com/delicb/kioto/cliware"
+	"github.com/delicb/kioto/middlewares/retry"
+)
+
+// ErrRateLimited is returned by limiter configured with FailFast option when
+// request would exceed rate limit.
+var ErrRateLimited = errors.New("ratelimit: rate limit exceeded")
+
+// Option is function that configures Limiter.
+type Option func(l *Limiter)
+
+// PerHost causes limits to be enforced separately for each URL host. URL is
+// set by request specific middlewares, so limiter has to be added to client
+// with Client.UsePost (or kioto.PostMiddlewares option) for this to work.
+func PerHost() Option {
+	return KeyFunc(func(req *http.Request) string {
+		return req.URL.Host
+	})
+}
+
+// PerContextKey causes limits to be enforced separately for each value stored
+// in request context under provided key. Requests without value share one
+// limit.
+func PerContextKey(key interface{}) Option {
+	return KeyFunc(func(req *http.Request) string {
+		value := req.Context().Value(key)
+		if value == nil {
+			return ""
+		}
+		return fmt.Sprint(value)
+	})
+}
+
+// KeyFunc sets function that determines to which limit request belongs.
+func KeyFunc(keyFunc func(req *http.Request) string) Option {
+	return func(l *Limiter) {
+		l.keyFunc = keyFunc
+	}
+}
+
+// FailFast causes requests that would exceed limit to fail immediately with
+// ErrRateLimited, instead of waiting until they are allowed. Retry attempts
+// always wait, since request is already being sent.
+func FailFast() Option {
+	return func(l *Limiter) {
+		l.failFast = true
+	}
+}
+
+// Limiter is cliware.Middleware that enforces requests per second and burst
+// limits using token bucket algorithm. By default, single limit is shared by
+// all requests. Same instance should be used for all requests to share
+// state, e.g. by adding it to client with Client.UsePost.
+//
+// Every attempt of sending request takes a token, including attempts made
+// by retry package, so retries do not exceed the limit.
+type Limiter struct {
+	rate     float64
+	burst    float64
+	keyFunc  func(req *http.Request) string
+	failFast bool
+	now      func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// New creates new Limiter that allows requestsPerSecond requests on average,
+// with bursts of up to burst requests. requestsPerSecond must be positive,
+// New panics otherwise.
+func New(requestsPerSecond float64, burst int, options ...Option) *Limiter {
+	// negated, so that NaN is rejected as well
+	if !(requestsPerSecond > 0) {
+		panic(fmt.Sprintf("ratelimit: non-positive requests per second: %v", requestsPerSecond))
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	l := &Limiter{
+		rate:    requestsPerSecond,
+		burst:   float64(burst),
+		keyFunc: func(req *http.Request) string { return "" },
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+	for _, opt := range options {
+		opt(l)
+	}
+	return l
+}
+
+// Exec is implementation of cliware.Middleware interface.
+func (l *Limiter) Exec(next c.Handler) c.Handler {
+	return c.HandlerFunc(func(req *http.Request) (resp *http.Response, err error) {
+		key := l.keyFunc(req)
+		if err := l.Wait(req.Context(), key); err != nil {
+			return nil, err
+		}
+		// first attempt already took its token, retries happen inside
+		// retry transport, after this middleware
+		handler := retry.OnAttempt(func(attempt int, req *http.Request) {
+			if attempt > 1 {
+				// error means that context is done, which attempt
+				// itself will report
+				_ = l.wait(req.Context(), key, false)
+			}
+		}).Exec(next)
+		return handler.Handle(req)
+	})
+}
+
+// Wait blocks until request with provided key is allowed or until provided
+// context is done. If limiter is configured to fail fast, it does not block,
+// but returns ErrRateLimited instead.
+func (l *Limiter) Wait(ctx context.Context, key string) error {
+	return l.wait(ctx, key, l.failFast)
+}
+
+func (l *Limiter) wait(ctx context.Context, key string, failFast bool) error {
+	b := l.bucket(key)
+	if failFast {
+		if !b.allow(l.now()) {
+			return ErrRateLimited
+		}
+		return nil
+	}
+
+	delay := b.reserve(l.now())
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		b.cancel()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (l *Limiter) bucket(key string) *bucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{
+			rate:   l.rate,
+			burst:  l.burst,
+			tokens: l.burst,
+			last:   l.now(),
+		}
+		l.buckets[key] = b
+	}
+	return b
+}
+
+// bucket is single token bucket. Number of tokens can be negative, which
+// means that tokens are reserved by waiting requests.
+type bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// refill adds tokens accumulated since last refill. Must be called with
+// lock held.
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last)
+	if elapsed <= 0 {
+		return
+	}
+	b.last = now
+	b.tokens += elapsed.Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// allow takes one token if one is available right now.
+func (b *bucket) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// reserve takes one token and returns for how long caller has to wait
+// before token becomes available.
+func (b *bucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel returns token taken by reserve that will not be used.
+func (b *bucket) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens++
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
@@ -0,0 +1,193 @@
+package ratelimit_test
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/delicb/kioto"
+	"github.com/delicb/kioto/cliware"
+	"github.com/delicb/kioto/middlewares/ratelimit"
+	"github.com/delicb/kioto/middlewares/retry"
+)
+
+type ctxKey string
+
+func createHandler(calls *int) cliware.Handler {
+	return cliware.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		*calls++
+		return &http.Response{StatusCode: 200, Request: req}, nil
+	})
+}
+
+func request(host string) *http.Request {
+	req := cliware.EmptyRequest()
+	req.URL = &url.URL{Scheme: "https", Host: host, Path: "/"}
+	return req
+}
+
+func TestLimiterWaits(t *testing.T) {
+	calls := 0
+	limiter := ratelimit.New(50, 2)
+	h := limiter.Exec(createHandler(&calls))
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if _, err := h.Handle(request("delic.rs")); err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+	}
+	// burst of two is immediate, other two requests wait 20ms each
+	if elapsed := time.Since(start); elapsed < 35*time.Millisecond {
+		t.Errorf("Requests not limited, took: %s.", elapsed)
+	}
+	if calls != 4 {
+		t.Errorf("Wrong number of calls. Got: %d, expected: 4.", calls)
+	}
+}
+
+func TestLimiterNonPositiveRate(t *testing.T) {
+	for _, rate := range []float64{0, -1, math.NaN()} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected panic for rate %v.", rate)
+				}
+			}()
+			ratelimit.New(rate, 1)
+		}()
+	}
+}
+
+func TestLimiterFailFast(t *testing.T) {
+	calls := 0
+	limiter := ratelimit.New(1, 1, ratelimit.FailFast())
+	h := limiter.Exec(createHandler(&calls))
+
+	if _, err := h.Handle(request("delic.rs")); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if _, err := h.Handle(request("delic.rs")); err != ratelimit.ErrRateLimited {
+		t.Errorf("Wrong error. Got: %v, expected: %v.", err, ratelimit.ErrRateLimited)
+	}
+	if calls != 1 {
+		t.Errorf("Wrong number of calls. Got: %d, expected: 1.", calls)
+	}
+}
+
+func TestLimiterContextCanceled(t *testing.T) {
+	calls := 0
+	limiter := ratelimit.New(0.001, 1)
+	h := limiter.Exec(createHandler(&calls))
+
+	if _, err := h.Handle(request("delic.rs")); err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := h.Handle(request("delic.rs").WithContext(ctx)); err != context.DeadlineExceeded {
+		t.Errorf("Wrong error. Got: %v, expected: %v.", err, context.DeadlineExceeded)
+	}
+	if calls != 1 {
+		t.Errorf("Wrong number of calls. Got: %d, expected: 1.", calls)
+	}
+}
+
+func TestLimiterPerHost(t *testing.T) {
+	calls := 0
+	limiter := ratelimit.New(1, 1, ratelimit.PerHost(), ratelimit.FailFast())
+	h := limiter.Exec(createHandler(&calls))
+
+	for _, host := range []string{"delic.rs", "golang.org"} {
+		if _, err := h.Handle(request(host)); err != nil {
+			t.Errorf("Unexpected error for %s: %v", host, err)
+		}
+	}
+	if _, err := h.Handle(request("delic.rs")); err != ratelimit.ErrRateLimited {
+		t.Errorf("Wrong error. Got: %v, expected: %v.", err, ratelimit.ErrRateLimited)
+	}
+}
+
+func TestLimiterPerContextKey(t *testing.T) {
+	calls := 0
+	key := ctxKey("tenant")
+	limiter := ratelimit.New(1, 1, ratelimit.PerContextKey(key), ratelimit.FailFast())
+	h := limiter.Exec(createHandler(&calls))
+
+	for _, tenant := range []string{"first", "second"} {
+		req := request("delic.rs")
+		req = req.WithContext(context.WithValue(req.Context(), key, tenant))
+		if _, err := h.Handle(req); err != nil {
+			t.Errorf("Unexpected error for %s: %v", tenant, err)
+		}
+	}
+	req := request("delic.rs")
+	req = req.WithContext(context.WithValue(req.Context(), key, "first"))
+	if _, err := h.Handle(req); err != ratelimit.ErrRateLimited {
+		t.Errorf("Wrong error. Got: %v, expected: %v.", err, ratelimit.ErrRateLimited)
+	}
+}
+
+func TestLimiterPerHostWithClient(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	first := httptest.NewServer(handler)
+	defer first.Close()
+	second := httptest.NewServer(handler)
+	defer second.Close()
+
+	limiter := ratelimit.New(0.1, 1, ratelimit.PerHost(), ratelimit.FailFast())
+	client := kioto.New(kioto.PostMiddlewares(limiter))
+
+	for _, u := range []string{first.URL, second.URL} {
+		resp, err := client.Request().Get().URL(u).Send()
+		if err != nil {
+			t.Fatalf("Unexpected error for %s: %v", u, err)
+		}
+		resp.Body.Close()
+	}
+	if _, err := client.Request().Get().URL(first.URL).Send(); err != ratelimit.ErrRateLimited {
+		t.Errorf("Wrong error. Got: %v, expected: %v.", err, ratelimit.ErrRateLimited)
+	}
+}
+
+func TestLimiterRetries(t *testing.T) {
+	var mu sync.Mutex
+	var attempts []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts = append(attempts, time.Now())
+		if len(attempts) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	limiter := ratelimit.New(20, 1, ratelimit.FailFast())
+	client := kioto.New(kioto.PostMiddlewares(limiter))
+	resp, err := client.Request().Get().URL(server.URL).Use(
+		retry.Times(2),
+		retry.SetClassifier(retry.On500PlusClassifier),
+		retry.SetBackoffStrategy(retry.ConstantBackoff(time.Millisecond)),
+	).Send()
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	resp.Body.Close()
+
+	if len(attempts) != 3 {
+		t.Fatalf("Wrong number of attempts. Got: %d, expected: 3.", len(attempts))
+	}
+	// every retry waits for token, 50ms at 20 requests per second
+	for i := 1; i < len(attempts); i++ {
+		if gap := attempts[i].Sub(attempts[i-1]); gap < 40*time.Millisecond {
+			t.Errorf("Retry %d not limited, sent after: %s.", i, gap)
+		}
+	}
+}
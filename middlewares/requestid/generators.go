@@ -0,0 +1,56 @@
+package requestid
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// Generator creates new request ID.
+type Generator func() string
+
+// UUIDv4 returns random UUID (version 4) in canonical textual form, e.g.
+// "3b241101-e2bb-4255-8caf-4136c566a962".
+func UUIDv4() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // variant RFC 4122
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// crockford is alphabet of Crockford's base32, used by ULID.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULID returns new ULID (Universally Unique Lexicographically Sortable
+// Identifier), made of current time in milliseconds and 80 random bits and
+// encoded as 26 characters long string. IDs generated in different
+// milliseconds sort in order in which they were generated.
+func ULID() string {
+	return newULID(time.Now())
+}
+
+func newULID(t time.Time) string {
+	var b [16]byte
+	ms := uint64(t.UnixNano() / int64(time.Millisecond))
+	b[0] = byte(ms >> 40)
+	b[1] = byte(ms >> 32)
+	b[2] = byte(ms >> 24)
+	b[3] = byte(ms >> 16)
+	b[4] = byte(ms >> 8)
+	b[5] = byte(ms)
+	_, _ = rand.Read(b[6:])
+
+	// 128 bits are encoded in 26 characters of 5 bits each, first character
+	// holds only 3 most significant bits
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	out := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out)
+}
@@ -0,0 +1,153 @@
+// Package requestid contains middleware that propagates request (correlation)
+// ID to servers, so that logs of different services can be correlated.
+//
+// ID is taken from request context (see WithID) or generated if context does
+// not contain it. The same ID is sent with every attempt of sending request
+// when request is retried, while number of attempt is sent in separate
+// header.
+package requestid
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	c "github.com/delicb/kioto/cliware"
+	"github.com/delicb/kioto/middlewares/retry"
+)
+
+const (
+	// DefaultHeader is name of the header in which request ID is sent.
+	DefaultHeader = "X-Request-ID"
+	// DefaultAttemptHeader is name of the header in which number of attempt
+	// of sending request is sent.
+	DefaultAttemptHeader = "X-Request-Attempt"
+)
+
+type contextKeyType int
+
+const (
+	idKey contextKeyType = iota
+	stateKey
+)
+
+// WithID returns copy of provided context with request ID. Middleware sends
+// this ID instead of generating new one.
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, idKey, id)
+}
+
+// FromContext returns request ID from provided context or empty string if
+// context does not contain it. After middleware is executed, request context
+// always contains ID that was sent.
+func FromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(idKey).(string)
+	return id
+}
+
+// state holds information about executed middleware, needed to read ID
+// server returned in response.
+type state struct {
+	responseHeader string
+}
+
+// FromResponse returns request ID server echoed in response, or empty string
+// if server did not return it or middleware was not used for request.
+func FromResponse(resp *http.Response) string {
+	if resp == nil || resp.Request == nil {
+		return ""
+	}
+	s, ok := resp.Request.Context().Value(stateKey).(*state)
+	if !ok {
+		return ""
+	}
+	return resp.Header.Get(s.responseHeader)
+}
+
+// Option configures Middleware.
+type Option func(*Middleware)
+
+// Header sets name of the header in which request ID is sent. Default is
+// DefaultHeader.
+func Header(name string) Option {
+	return func(m *Middleware) {
+		m.header = name
+	}
+}
+
+// ResponseHeader sets name of the header from which ID echoed by server is
+// read. By default, it is the same header in which ID is sent.
+func ResponseHeader(name string) Option {
+	return func(m *Middleware) {
+		m.responseHeader = name
+	}
+}
+
+// AttemptHeader sets name of the header in which number of attempt (starting
+// from 1) is sent. Default is DefaultAttemptHeader. Empty name disables
+// attempt header.
+func AttemptHeader(name string) Option {
+	return func(m *Middleware) {
+		m.attemptHeader = name
+	}
+}
+
+// Generate sets generator of request IDs, used when context does not contain
+// one. Default is UUIDv4.
+func Generate(generator Generator) Option {
+	return func(m *Middleware) {
+		m.generate = generator
+	}
+}
+
+// Middleware sets request ID header on outgoing requests.
+type Middleware struct {
+	header         string
+	responseHeader string
+	attemptHeader  string
+	generate       Generator
+}
+
+// New creates middleware configured with provided options.
+func New(opts ...Option) *Middleware {
+	m := &Middleware{
+		header:        DefaultHeader,
+		attemptHeader: DefaultAttemptHeader,
+		generate:      UUIDv4,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.responseHeader == "" {
+		m.responseHeader = m.header
+	}
+	return m
+}
+
+// Exec implements cliware.Middleware interface.
+func (m *Middleware) Exec(next c.Handler) c.Handler {
+	return c.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		ctx := req.Context()
+		id := FromContext(ctx)
+		if id == "" {
+			id = m.generate()
+			ctx = WithID(ctx, id)
+		}
+		ctx = context.WithValue(ctx, stateKey, &state{responseHeader: m.responseHeader})
+
+		req.Header.Set(m.header, id)
+		handler := next
+		if m.attemptHeader != "" {
+			// without retry transport hook is never called, so first
+			// attempt is marked here
+			req.Header.Set(m.attemptHeader, "1")
+			handler = retry.OnAttempt(func(attempt int, req *http.Request) {
+				req.Header.Set(m.attemptHeader, strconv.Itoa(attempt))
+			}).Exec(next)
+		}
+		return handler.Handle(req.WithContext(ctx))
+	})
+}
@@ -0,0 +1,133 @@
+package requestid_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/delicb/kioto"
+	"github.com/delicb/kioto/cliware"
+	"github.com/delicb/kioto/middlewares/requestid"
+	"github.com/delicb/kioto/middlewares/retry"
+)
+
+func TestUUIDv4(t *testing.T) {
+	re := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		id := requestid.UUIDv4()
+		assert.Regexp(t, re, id)
+		assert.False(t, seen[id], "duplicate ID")
+		seen[id] = true
+	}
+}
+
+func TestULID(t *testing.T) {
+	re := regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)
+	var ids []string
+	for i := 0; i < 3; i++ {
+		id := requestid.ULID()
+		assert.Regexp(t, re, id)
+		ids = append(ids, id)
+		time.Sleep(2 * time.Millisecond)
+	}
+	assert.True(t, sort.StringsAreSorted(ids), "ULIDs not sortable by time: %v", ids)
+}
+
+type server struct {
+	mu       sync.Mutex
+	ids      []string
+	attempts []string
+	failures int
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ids = append(s.ids, r.Header.Get("X-Request-ID"))
+	s.attempts = append(s.attempts, r.Header.Get("X-Request-Attempt"))
+	w.Header().Set("X-Request-ID", r.Header.Get("X-Request-ID"))
+	if len(s.ids) <= s.failures {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+}
+
+func TestMiddlewareRetries(t *testing.T) {
+	handler := &server{failures: 2}
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	client := kioto.New(kioto.Middlewares(requestid.New()))
+	resp, err := client.Request().URL(srv.URL).Use(
+		retry.Times(2),
+		retry.SetClassifier(retry.On500PlusClassifier),
+		retry.SetBackoffStrategy(retry.ConstantBackoff(time.Millisecond)),
+	).Send()
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	require.Len(t, handler.ids, 3)
+	assert.NotEmpty(t, handler.ids[0])
+	assert.Equal(t, []string{handler.ids[0], handler.ids[0], handler.ids[0]}, handler.ids)
+	assert.Equal(t, []string{"1", "2", "3"}, handler.attempts)
+	assert.Equal(t, handler.ids[0], resp.RequestID)
+}
+
+func TestMiddlewareFromContext(t *testing.T) {
+	handler := &server{}
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	client := kioto.New(kioto.Middlewares(requestid.New()))
+	ctx := requestid.WithID(context.Background(), "my-id")
+	resp, err := client.Do(ctx, cliware.RequestProcessor(func(req *http.Request) error {
+		req.URL, _ = req.URL.Parse(srv.URL)
+		return nil
+	}))
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, []string{"my-id"}, handler.ids)
+	assert.Equal(t, "my-id", resp.RequestID)
+}
+
+func TestMiddlewareOptions(t *testing.T) {
+	var req *http.Request
+	handler := cliware.HandlerFunc(func(r *http.Request) (*http.Response, error) {
+		req = r
+		header := http.Header{}
+		header.Set("X-Correlation-Echo", "echoed")
+		return &http.Response{StatusCode: 200, Header: header, Request: r}, nil
+	})
+	m := requestid.New(
+		requestid.Header("X-Correlation-ID"),
+		requestid.ResponseHeader("X-Correlation-Echo"),
+		requestid.AttemptHeader(""),
+		requestid.Generate(func() string { return "generated" }),
+	)
+	resp, err := m.Exec(handler).Handle(cliware.EmptyRequest())
+	require.NoError(t, err)
+
+	assert.Equal(t, "generated", req.Header.Get("X-Correlation-ID"))
+	assert.Empty(t, req.Header.Get("X-Request-ID"))
+	assert.Empty(t, req.Header.Get(requestid.DefaultAttemptHeader))
+	assert.Equal(t, "generated", requestid.FromContext(req.Context()))
+	assert.Equal(t, "echoed", requestid.FromResponse(resp))
+}
+
+func TestFromResponseWithoutMiddleware(t *testing.T) {
+	header := http.Header{}
+	header.Set("X-Request-ID", "id")
+	resp := &http.Response{Header: header, Request: cliware.EmptyRequest()}
+	assert.Empty(t, requestid.FromResponse(resp))
+	assert.Empty(t, requestid.FromResponse(nil))
+	assert.Empty(t, requestid.FromContext(context.Background()))
+}
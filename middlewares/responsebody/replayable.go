@@ -0,0 +1,190 @@
+package responsebody
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"runtime"
+	"sync"
+
+	c "github.com/delicb/kioto/cliware"
+)
+
+// DefaultMemLimit is number of bytes ReplayableBody keeps in memory if
+// limit is not provided.
+const DefaultMemLimit = 1 << 20
+
+// ReplayableBody is response body that can be read multiple times. Content is
+// buffered in memory up to configured limit and spilled to temporary file
+// beyond it. Closing ReplayableBody does not release the buffer, it rewinds it
+// instead, so that next reader gets whole content again. Release should be
+// called when body is not needed any more to free the buffer and close
+// temporary file, if any. Temporary file is removed from disk as soon as it
+// is created and it is closed when body is garbage collected at the latest,
+// so it does not leak even if Release is not called.
+type ReplayableBody struct {
+	mu     sync.Mutex
+	mem    []byte
+	file   *os.File
+	name   string // set only if file could not be removed while open
+	size   int64
+	reader io.ReadSeeker
+}
+
+// NewReplayableBody reads whole content of provided reader and returns
+// ReplayableBody holding it. Up to memLimit bytes are kept in memory, if
+// content is larger it is written to temporary file. If memLimit is not
+// positive, DefaultMemLimit is used. Provided reader is not closed.
+func NewReplayableBody(r io.Reader, memLimit int64) (*ReplayableBody, error) {
+	if memLimit <= 0 {
+		memLimit = DefaultMemLimit
+	}
+	buff := &bytes.Buffer{}
+	n, err := io.CopyN(buff, r, memLimit+1)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if n <= memLimit {
+		mem := buff.Bytes()
+		return &ReplayableBody{
+			mem:    mem,
+			size:   int64(len(mem)),
+			reader: bytes.NewReader(mem),
+		}, nil
+	}
+
+	file, err := ioutil.TempFile("", "kioto-body-")
+	if err != nil {
+		return nil, err
+	}
+	// content stays accessible through open file, while disk space is freed
+	// when file is closed. Where open file can not be removed (Windows), it
+	// is removed by Release.
+	var name string
+	if os.Remove(file.Name()) != nil {
+		name = file.Name()
+	}
+	size, err := io.Copy(file, io.MultiReader(buff, r))
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		if name != "" {
+			os.Remove(name)
+		}
+		return nil, err
+	}
+	body := &ReplayableBody{
+		file:   file,
+		name:   name,
+		size:   size,
+		reader: file,
+	}
+	runtime.SetFinalizer(body, (*ReplayableBody).Release)
+	return body, nil
+}
+
+// Read is implementation of io.Reader interface.
+func (b *ReplayableBody) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.reader == nil {
+		return 0, os.ErrClosed
+	}
+	return b.reader.Read(p)
+}
+
+// Close rewinds body to the beginning, so that it can be read again.
+func (b *ReplayableBody) Close() error {
+	return b.Rewind()
+}
+
+// Rewind sets reading position to the beginning of the body.
+func (b *ReplayableBody) Rewind() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.reader == nil {
+		return os.ErrClosed
+	}
+	_, err := b.reader.Seek(0, io.SeekStart)
+	return err
+}
+
+// Bytes returns whole content of the body, regardless of current reading
+// position.
+func (b *ReplayableBody) Bytes() ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.reader == nil {
+		return nil, os.ErrClosed
+	}
+	if b.file == nil {
+		return b.mem, nil
+	}
+	data := make([]byte, b.size)
+	_, err := b.file.ReadAt(data, 0)
+	if err == io.EOF {
+		err = nil
+	}
+	return data, err
+}
+
+// Len returns size of the body in bytes.
+func (b *ReplayableBody) Len() int64 {
+	return b.size
+}
+
+// Release frees buffered content and closes temporary file, if it was
+// created. Body can not be read after it is released.
+func (b *ReplayableBody) Release() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.mem = nil
+	b.reader = nil
+	if b.file == nil {
+		return nil
+	}
+	runtime.SetFinalizer(b, nil)
+	file := b.file
+	b.file = nil
+	err := file.Close()
+	if b.name == "" {
+		return err
+	}
+	if removeErr := os.Remove(b.name); err == nil {
+		err = removeErr
+	}
+	return err
+}
+
+// Replayable buffers response body into ReplayableBody, so that it can be
+// read by multiple response processors (e.g. logged and then decoded) and by
+// Response helpers. Up to memLimit bytes are kept in memory, larger bodies
+// are spilled to temporary file.
+//
+// Response processors are executed in reverse order, so for other middlewares
+// to see replayable body, this middleware needs to be executed after them,
+// e.g. by adding it with Client.UsePost.
+func Replayable(memLimit int64) c.Middleware {
+	return c.ResponseProcessor(func(resp *http.Response, err error) error {
+		if resp == nil || resp.Body == nil {
+			return nil
+		}
+		if _, ok := resp.Body.(*ReplayableBody); ok {
+			return nil
+		}
+		body, bodyErr := NewReplayableBody(resp.Body, memLimit)
+		closeErr := resp.Body.Close()
+		if bodyErr != nil {
+			return bodyErr
+		}
+		resp.Body = body
+		if resp.ContentLength < 0 {
+			resp.ContentLength = body.Len()
+		}
+		return closeErr
+	})
+}
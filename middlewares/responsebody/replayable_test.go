@@ -0,0 +1,105 @@
+package responsebody_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/delicb/kioto/cliware"
+	"github.com/delicb/kioto/middlewares/responsebody"
+)
+
+func TestReplayableBodyMemory(t *testing.T) {
+	body, err := responsebody.NewReplayableBody(strings.NewReader("content"), 100)
+	require.NoError(t, err)
+	defer body.Release()
+
+	for i := 0; i < 2; i++ {
+		data, err := ioutil.ReadAll(body)
+		require.NoError(t, err)
+		assert.Equal(t, "content", string(data))
+		require.NoError(t, body.Close())
+	}
+	assert.Equal(t, int64(7), body.Len())
+}
+
+func TestReplayableBodySpill(t *testing.T) {
+	content := strings.Repeat("x", 100)
+	body, err := responsebody.NewReplayableBody(strings.NewReader(content), 10)
+	require.NoError(t, err)
+
+	half := make([]byte, 50)
+	_, err = body.Read(half)
+	require.NoError(t, err)
+
+	data, err := body.Bytes()
+	require.NoError(t, err)
+	assert.Equal(t, content, string(data), "bytes depend on reading position")
+
+	rest, err := ioutil.ReadAll(body)
+	require.NoError(t, err)
+	assert.Len(t, rest, 50)
+
+	require.NoError(t, body.Rewind())
+	data, err = ioutil.ReadAll(body)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(data))
+	assert.Equal(t, int64(100), body.Len())
+
+	require.NoError(t, body.Release())
+	_, err = body.Read(half)
+	assert.Error(t, err, "read after release")
+}
+
+func TestReplayable(t *testing.T) {
+	handler := func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			Body:          ioutil.NopCloser(strings.NewReader(`{"foo": "bar"}`)),
+			ContentLength: -1,
+		}, nil
+	}
+	var raw string
+	var decoded map[string]interface{}
+	chain := cliware.NewChain(
+		responsebody.JSON(&decoded),
+		responsebody.String(&raw),
+		responsebody.Replayable(1024),
+	)
+	resp, err := chain.Exec(cliware.HandlerFunc(handler)).Handle(cliware.EmptyRequest())
+	require.NoError(t, err)
+	assert.Equal(t, `{"foo": "bar"}`, raw)
+	assert.Equal(t, map[string]interface{}{"foo": "bar"}, decoded)
+	assert.Equal(t, int64(14), resp.ContentLength)
+
+	data, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, raw, string(data))
+}
+
+func TestReplayableBodyTempFileRemoved(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kioto-replayable")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	t.Setenv("TMPDIR", dir)
+
+	content := strings.Repeat("x", 100)
+	body, err := responsebody.NewReplayableBody(strings.NewReader(content), 10)
+	require.NoError(t, err)
+
+	data, err := ioutil.ReadAll(body)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(data))
+	require.NoError(t, body.Close())
+
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, files, "temporary file left on disk")
+
+	require.NoError(t, body.Release())
+	require.NoError(t, body.Release(), "second release")
+}
@@ -0,0 +1,65 @@
+package retry
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrBudgetExhausted is returned when request should be retried according to
+// classifier, but retry budget does not allow any more retries.
+var ErrBudgetExhausted = errors.New("retry: retry budget exhausted")
+
+// Budget limits number of retries to a ratio of successful requests. It is
+// token bucket, where every request that is not retried deposits ratio of a
+// token and every retry withdraws one whole token. When bucket is empty,
+// requests are not retried any more, which prevents retry storms when some
+// dependency is down. Single Budget is meant to be shared between many
+// requests (e.g. all requests made by one client) and is safe for concurrent
+// use.
+type Budget struct {
+	mu     sync.Mutex
+	ratio  float64
+	max    float64
+	tokens float64
+}
+
+// NewBudget creates new retry budget that allows ratio retries per successful
+// request (e.g. 0.1 allows one retry for every ten successful requests).
+// Burst is maximal number of tokens in bucket and budget starts full, so that
+// retries are possible even before any request succeeds.
+func NewBudget(ratio float64, burst int) *Budget {
+	return &Budget{
+		ratio:  ratio,
+		max:    float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+// Available returns number of retries budget currently allows.
+func (b *Budget) Available() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return int(b.tokens)
+}
+
+// deposit adds tokens to budget for single successful request.
+func (b *Budget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens += b.ratio
+	if b.tokens > b.max {
+		b.tokens = b.max
+	}
+}
+
+// withdraw takes one token from budget for single retry. Returned value
+// indicates if retry is allowed.
+func (b *Budget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
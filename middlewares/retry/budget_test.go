@@ -0,0 +1,70 @@
+package retry
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/delicb/kioto/cliware"
+)
+
+func TestBudget(t *testing.T) {
+	budget := NewBudget(0.5, 2)
+	if got := budget.Available(); got != 2 {
+		t.Errorf("Wrong initial budget. Got: %d, expected: 2.", got)
+	}
+	for i := 0; i < 2; i++ {
+		if !budget.withdraw() {
+			t.Fatalf("Withdraw %d not allowed by full budget.", i)
+		}
+	}
+	if budget.withdraw() {
+		t.Error("Withdraw allowed by empty budget.")
+	}
+
+	budget.deposit()
+	if budget.withdraw() {
+		t.Error("Withdraw allowed after single deposit with ratio 0.5.")
+	}
+	budget.deposit()
+	if !budget.withdraw() {
+		t.Error("Withdraw not allowed after two deposits with ratio 0.5.")
+	}
+
+	for i := 0; i < 10; i++ {
+		budget.deposit()
+	}
+	if got := budget.Available(); got != 2 {
+		t.Errorf("Budget not capped by burst. Got: %d, expected: 2.", got)
+	}
+}
+
+func TestRetryTransport_RoundTripBudget(t *testing.T) {
+	budget := NewBudget(0.25, 1)
+	mock := &mockRoundTripper{err: errors.New("my error")}
+	transport := NewRetryTransport(mock)
+
+	req := cliware.EmptyRequest()
+	req = req.WithContext(setRetryTimes(req.Context(), 5))
+	req = req.WithContext(setBackoff(req.Context(), ConstantBackoff(time.Millisecond)))
+	req = req.WithContext(setBudget(req.Context(), budget))
+
+	_, err := transport.RoundTrip(req)
+	if err != ErrBudgetExhausted {
+		t.Errorf("Wrong error. Got: %v, expected: %v.", err, ErrBudgetExhausted)
+	}
+	if mock.calledCount != 2 {
+		t.Errorf("Wrong number of calls. Got: %d, expected: 2.", mock.calledCount)
+	}
+
+	// successful requests should refill budget
+	mock.err = nil
+	for i := 0; i < 4; i++ {
+		if _, err := transport.RoundTrip(req); err != nil {
+			t.Fatal("Unexpected error:", err)
+		}
+	}
+	if got := budget.Available(); got != 1 {
+		t.Errorf("Budget not refilled by successful requests. Got: %d, expected: 1.", got)
+	}
+}
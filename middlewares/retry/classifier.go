@@ -18,6 +18,17 @@ func On500PlusClassifier(resp *http.Response, err error) bool {
 	return err != nil || resp.StatusCode >= 500
 }
 
+// RateLimitedClassifier is classifier that indicates that all requests whose
+// response code is 429 (Too Many Requests) or 503 (Service Unavailable) should
+// be repeated. It is best combined with HonorRetryAfter middleware, so that
+// delay requested by server is respected.
+func RateLimitedClassifier(resp *http.Response, err error) bool {
+	if resp == nil {
+		return false
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable
+}
+
 // OrClassifier is classifier that combines other classifiers. Returned classifier
 // will indicate that request should be repeated if any or provided classifiers
 // returned true.
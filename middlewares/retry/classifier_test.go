@@ -36,6 +36,23 @@ func TestOn500PlusClassifier(t *testing.T) {
 	}
 }
 
+func TestRateLimitedClassifier(t *testing.T) {
+	for resp, expected := range map[*http.Response]bool{
+		{StatusCode: 200}: false,
+		{StatusCode: 400}: false,
+		{StatusCode: 429}: true,
+		{StatusCode: 500}: false,
+		{StatusCode: 503}: true,
+	} {
+		if retry.RateLimitedClassifier(resp, nil) != expected {
+			t.Errorf("RateLimitedClassifier wrong value for %d. Expected: %t", resp.StatusCode, expected)
+		}
+	}
+	if retry.RateLimitedClassifier(nil, errors.New("some error")) {
+		t.Error("RateLimitedClassifier returned true for missing response.")
+	}
+}
+
 var (
 	trueClassifier = retry.Classifier(func(resp *http.Response, err error) bool {
 		return true
@@ -16,6 +16,10 @@ var (
 	classifierKey   retryConfigKey = "classifier"
 	bodyStrategyKey retryConfigKey = "body-strategy"
 	retryMethodsKey retryConfigKey = "retry-methods"
+	retryHooksKey   retryConfigKey = "retry-hooks"
+	retryAfterKey   retryConfigKey = "retry-after"
+	budgetKey       retryConfigKey = "budget"
+	attemptHooksKey retryConfigKey = "attempt-hooks"
 )
 
 // setRetryTimes sets provided number of retry times to provided context and
@@ -114,3 +118,76 @@ func getRetryMethods(ctx context.Context) []string {
 	}
 	return retryMethods.([]string)
 }
+
+// setHonorRetryAfter sets flag that indicates if Retry-After header should be
+// used to calculate delay to provided context and returns new context.
+func setHonorRetryAfter(ctx context.Context, honor bool) context.Context {
+	return context.WithValue(ctx, retryAfterKey, honor)
+}
+
+// getHonorRetryAfter returns flag that indicates if Retry-After header should
+// be used to calculate delay from provided context or false if provided
+// context does not contain value for it.
+func getHonorRetryAfter(ctx context.Context) bool {
+	honor := ctx.Value(retryAfterKey)
+	if honor == nil {
+		return false
+	}
+	return honor.(bool)
+}
+
+// setBudget sets provided retry budget to provided context and returns new
+// context.
+func setBudget(ctx context.Context, budget *Budget) context.Context {
+	return context.WithValue(ctx, budgetKey, budget)
+}
+
+// getBudget returns retry budget from provided context or nil if provided
+// context does not contain value for retry budget.
+func getBudget(ctx context.Context) *Budget {
+	budget := ctx.Value(budgetKey)
+	if budget == nil {
+		return nil
+	}
+	return budget.(*Budget)
+}
+
+// addRetryHook appends provided hook to list of hooks already present in
+// provided context and returns new context.
+func addRetryHook(ctx context.Context, hook RetryHook) context.Context {
+	existing := getRetryHooks(ctx)
+	hooks := make([]RetryHook, 0, len(existing)+1)
+	hooks = append(hooks, existing...)
+	hooks = append(hooks, hook)
+	return context.WithValue(ctx, retryHooksKey, hooks)
+}
+
+// getRetryHooks returns slice of retry hooks from provided context or nil
+// if provided context does not contain any hooks.
+func getRetryHooks(ctx context.Context) []RetryHook {
+	hooks := ctx.Value(retryHooksKey)
+	if hooks == nil {
+		return nil
+	}
+	return hooks.([]RetryHook)
+}
+
+// addAttemptHook appends provided hook to list of attempt hooks already
+// present in provided context and returns new context.
+func addAttemptHook(ctx context.Context, hook AttemptHook) context.Context {
+	existing := getAttemptHooks(ctx)
+	hooks := make([]AttemptHook, 0, len(existing)+1)
+	hooks = append(hooks, existing...)
+	hooks = append(hooks, hook)
+	return context.WithValue(ctx, attemptHooksKey, hooks)
+}
+
+// getAttemptHooks returns slice of attempt hooks from provided context or
+// nil if provided context does not contain any hooks.
+func getAttemptHooks(ctx context.Context) []AttemptHook {
+	hooks := ctx.Value(attemptHooksKey)
+	if hooks == nil {
+		return nil
+	}
+	return hooks.([]AttemptHook)
+}
@@ -0,0 +1,19 @@
+package retry
+
+import (
+	"net/http"
+	"time"
+)
+
+// RetryHook is function that is called when request is about to be retried.
+// Attempt is number of attempt that just finished (first request is attempt
+// number 1), resp and err are results of that attempt and delay is time that
+// will be waited before sending next attempt.
+type RetryHook func(attempt int, resp *http.Response, err error, delay time.Duration)
+
+// AttemptHook is function that is called before every attempt of sending
+// request, including the first one. Attempt is number of attempt that is
+// about to be sent (first request is attempt number 1) and req is request
+// that will be sent. Hook can modify headers of provided request, which
+// affects only that attempt.
+type AttemptHook func(attempt int, req *http.Request)
@@ -42,6 +42,8 @@ func MaxDuration(maxTime time.Duration) c.Middleware {
 }
 
 // SetBodyStrategy sets strategy of how to handle request body for retries requests.
+// Strategy is used only for requests whose method can be retried. If it is not
+// set, request GetBody is used when available and body is cached otherwise.
 func SetBodyStrategy(strategy func(r *http.Request) (func() io.ReadCloser, error)) c.Middleware {
 	return c.ContextProcessor(func(ctx context.Context) context.Context {
 		return setBodyStrategy(ctx, BodyStrategy(strategy))
@@ -57,3 +59,47 @@ func Methods(methods ...string) c.Middleware {
 		return setRetryMethods(ctx, methods...)
 	})
 }
+
+// HonorRetryAfter causes delay between retries to be taken from Retry-After
+// header of response (if present) instead of from backoff strategy. Delay is
+// capped by time remaining until MaxDuration is reached. Useful for rate
+// limited APIs, together with RateLimitedClassifier.
+func HonorRetryAfter() c.Middleware {
+	return c.ContextProcessor(func(ctx context.Context) context.Context {
+		return setHonorRetryAfter(ctx, true)
+	})
+}
+
+// UseBudget sets retry budget that will be consulted before every retry.
+// If budget is exhausted, request fails with ErrBudgetExhausted instead of
+// being retried. Same budget should be used for many requests, usually all
+// requests made by one client.
+func UseBudget(budget *Budget) c.Middleware {
+	return c.ContextProcessor(func(ctx context.Context) context.Context {
+		return setBudget(ctx, budget)
+	})
+}
+
+// OnRetry adds hook that will be called every time request is about to be
+// retried. Hook receives number of attempt that just finished, response or
+// error that attempt produced and delay before next attempt. Multiple hooks
+// can be added, they are called in order in which they were added.
+//
+// Response passed to hook will be discarded after hook returns, so hook must
+// not keep reference to it or read its body.
+func OnRetry(hook func(attempt int, resp *http.Response, err error, delay time.Duration)) c.Middleware {
+	return c.ContextProcessor(func(ctx context.Context) context.Context {
+		return addRetryHook(ctx, RetryHook(hook))
+	})
+}
+
+// OnAttempt adds hook that will be called before every attempt of sending
+// request, including the first one. Hook receives number of attempt and
+// request that is about to be sent. Headers of provided request are copied
+// for every attempt, so hook can modify them (e.g. to add per attempt
+// tracing headers) without affecting other attempts.
+func OnAttempt(hook func(attempt int, req *http.Request)) c.Middleware {
+	return c.ContextProcessor(func(ctx context.Context) context.Context {
+		return addAttemptHook(ctx, AttemptHook(hook))
+	})
+}
@@ -131,3 +131,56 @@ func createHandler() cliware.Handler {
 		}, nil
 	})
 }
+
+func TestOnRetry(t *testing.T) {
+	hook := func(attempt int, resp *http.Response, err error, delay time.Duration) {}
+	chain := cliware.NewChain(OnRetry(hook), OnRetry(hook))
+	req := cliware.EmptyRequest()
+	resp, err := chain.Exec(createHandler()).Handle(req)
+	if err != nil {
+		t.Error("Handle returned error:", err)
+	}
+	got := getRetryHooks(resp.Request.Context())
+	if len(got) != 2 {
+		t.Errorf("Wrong number of retry hooks. Got: %d, expected: 2.", len(got))
+	}
+}
+
+func TestOnAttempt(t *testing.T) {
+	hook := func(attempt int, req *http.Request) {}
+	chain := cliware.NewChain(OnAttempt(hook), OnAttempt(hook))
+	req := cliware.EmptyRequest()
+	resp, err := chain.Exec(createHandler()).Handle(req)
+	if err != nil {
+		t.Error("Handle returned error:", err)
+	}
+	got := getAttemptHooks(resp.Request.Context())
+	if len(got) != 2 {
+		t.Errorf("Wrong number of attempt hooks. Got: %d, expected: 2.", len(got))
+	}
+}
+
+func TestHonorRetryAfter(t *testing.T) {
+	m := HonorRetryAfter()
+	req := cliware.EmptyRequest()
+	resp, err := m.Exec(createHandler()).Handle(req)
+	if err != nil {
+		t.Error("Handle returned error:", err)
+	}
+	if !getHonorRetryAfter(resp.Request.Context()) {
+		t.Error("Expected Retry-After to be honored.")
+	}
+}
+
+func TestUseBudget(t *testing.T) {
+	budget := NewBudget(0.1, 10)
+	m := UseBudget(budget)
+	req := cliware.EmptyRequest()
+	resp, err := m.Exec(createHandler()).Handle(req)
+	if err != nil {
+		t.Error("Handle returned error:", err)
+	}
+	if got := getBudget(resp.Request.Context()); got != budget {
+		t.Errorf("Wrong budget. Got: %p, expected: %p.", got, budget)
+	}
+}
@@ -0,0 +1,47 @@
+package retry
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseRetryAfter parses value of Retry-After HTTP header and returns duration
+// that client should wait before sending next request. Both forms defined in
+// RFC 7231 are supported, delay in seconds and HTTP date. HTTP date is
+// converted to duration relative to provided time. Date in the past results
+// in zero duration. Boolean return value indicates if value was valid.
+func ParseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	delay := date.Sub(now)
+	if delay < 0 {
+		delay = 0
+	}
+	return delay, true
+}
+
+// retryAfter returns delay requested by server via Retry-After header of
+// provided response. Boolean return value indicates if response contains
+// valid Retry-After header.
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	return ParseRetryAfter(resp.Header.Get("Retry-After"), now)
+}
@@ -0,0 +1,35 @@
+package retry_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/delicb/kioto/middlewares/retry"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2015, time.October, 21, 7, 28, 0, 0, time.UTC)
+	for _, data := range []struct {
+		Value    string
+		Expected time.Duration
+		Valid    bool
+	}{
+		{Value: "120", Expected: 2 * time.Minute, Valid: true},
+		{Value: " 0 ", Expected: 0, Valid: true},
+		{Value: "Wed, 21 Oct 2015 07:28:30 GMT", Expected: 30 * time.Second, Valid: true},
+		{Value: "Wednesday, 21-Oct-15 07:29:00 GMT", Expected: time.Minute, Valid: true},
+		{Value: "Wed, 21 Oct 2015 07:27:00 GMT", Expected: 0, Valid: true},
+		{Value: "", Valid: false},
+		{Value: "-5", Valid: false},
+		{Value: "soon", Valid: false},
+	} {
+		got, ok := retry.ParseRetryAfter(data.Value, now)
+		if ok != data.Valid {
+			t.Errorf("Wrong validity for %q. Got: %t, expected: %t.", data.Value, ok, data.Valid)
+			continue
+		}
+		if got != data.Expected {
+			t.Errorf("Wrong delay for %q. Got: %s, expected: %s.", data.Value, got, data.Expected)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package retry
 
 import (
 	"context"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"time"
 )
@@ -13,6 +15,12 @@ var (
 	defaultMaxDuration  = 3 * time.Minute
 	defaultBodyStrategy = CacheBodyStrategy
 	defaultRetryMethods = []string{"GET"}
+
+	// maxDrainBytes is maximal number of bytes that will be read from body of
+	// response that is discarded because request is retried. Reading body
+	// allows underlying connection to be reused, but for large bodies it is
+	// cheaper to close connection.
+	maxDrainBytes int64 = 4096
 )
 
 // Enable modifies provided client so that it can support all retry mechanisms
@@ -56,6 +64,10 @@ type retryTransportConfig struct {
 	MaxDuration  time.Duration
 	BodyStrategy BodyStrategy
 	RetryMethods []string
+	RetryHooks   []RetryHook
+	AttemptHooks []AttemptHook
+	RetryAfter   bool
+	Budget       *Budget
 }
 
 func newRetryTransportConfig(ctx context.Context) *retryTransportConfig {
@@ -66,6 +78,10 @@ func newRetryTransportConfig(ctx context.Context) *retryTransportConfig {
 		MaxDuration:  getMaxDuration(ctx),
 		BodyStrategy: getBodyStrategy(ctx),
 		RetryMethods: getRetryMethods(ctx),
+		RetryHooks:   getRetryHooks(ctx),
+		AttemptHooks: getAttemptHooks(ctx),
+		RetryAfter:   getHonorRetryAfter(ctx),
+		Budget:       getBudget(ctx),
 	}
 	if config.Classifier == nil {
 		config.Classifier = defaultClassifier
@@ -79,9 +95,6 @@ func newRetryTransportConfig(ctx context.Context) *retryTransportConfig {
 	if config.MaxDuration == time.Duration(0) {
 		config.MaxDuration = defaultMaxDuration
 	}
-	if config.BodyStrategy == nil {
-		config.BodyStrategy = defaultBodyStrategy
-	}
 	if config.RetryMethods == nil || len(config.RetryMethods) == 0 {
 		config.RetryMethods = defaultRetryMethods
 	}
@@ -91,9 +104,10 @@ func newRetryTransportConfig(ctx context.Context) *retryTransportConfig {
 func (t *retryTransport) RoundTrip(r *http.Request) (*http.Response, error) {
 	count := 0
 
-	config := newRetryTransportConfig(r.Context())
+	ctx := r.Context()
+	config := newRetryTransportConfig(ctx)
 
-	getBody, err := config.BodyStrategy(r)
+	getBody, err := requestBody(r, config)
 	if err != nil {
 		return nil, err
 	}
@@ -103,7 +117,21 @@ func (t *retryTransport) RoundTrip(r *http.Request) (*http.Response, error) {
 		// Copy request and sets its body to appropriate value
 		reqCopy := &http.Request{}
 		*reqCopy = *r
-		reqCopy.Body = getBody()
+		reqCopy.Body, err = getBody()
+		if err != nil {
+			return nil, err
+		}
+		if len(config.AttemptHooks) > 0 {
+			// hooks may modify headers, make sure that does not leak to
+			// original request and other attempts
+			reqCopy.Header = r.Header.Clone()
+			if reqCopy.Header == nil {
+				reqCopy.Header = make(http.Header)
+			}
+			for _, hook := range config.AttemptHooks {
+				hook(count+1, reqCopy)
+			}
+		}
 
 		// perform actual request
 		resp, err := t.next.RoundTrip(reqCopy)
@@ -111,19 +139,105 @@ func (t *retryTransport) RoundTrip(r *http.Request) (*http.Response, error) {
 		// check if we reached any of conditions for stopping retry cycle
 		classifier := !config.Classifier(resp, err)
 		maxRetries := count >= config.MaxRetries
-		supportedMethod := !stringInSlice(r.Method, config.RetryMethods)
+		supportedMethod := !stringInSlice(requestMethod(r), config.RetryMethods)
 
 		currentDuration := time.Now().UTC().Sub(start)
 		maxDuration := currentDuration.Nanoseconds() > config.MaxDuration.Nanoseconds()
 
 		if classifier || maxRetries || supportedMethod || maxDuration {
+			if classifier && config.Budget != nil {
+				config.Budget.deposit()
+			}
 			return resp, err
 		}
 
+		if config.Budget != nil && !config.Budget.withdraw() {
+			drainBody(resp)
+			return nil, ErrBudgetExhausted
+		}
+
 		// if all else failed, increase number of retries and wait for some time
 		count++
-		time.Sleep(config.Backoff(count))
+		delay := config.Backoff(count)
+		if config.RetryAfter {
+			if serverDelay, ok := retryAfter(resp, time.Now()); ok {
+				delay = minDuration(serverDelay, config.MaxDuration-currentDuration)
+			}
+		}
+		for _, hook := range config.RetryHooks {
+			hook(count, resp, err, delay)
+		}
+
+		// response of this attempt will never reach caller, so release
+		// resources it holds before waiting for next attempt
+		drainBody(resp)
+
+		if err := wait(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// requestBody returns function that provides body for every attempt of
+// provided request. Body of request whose method is not retried is used as
+// is, so streamed bodies are not buffered for attempt that will never happen.
+// Without explicitly configured body strategy, request GetBody is used if it
+// is set and body is cached in memory otherwise.
+func requestBody(r *http.Request, config *retryTransportConfig) (func() (io.ReadCloser, error), error) {
+	if !stringInSlice(requestMethod(r), config.RetryMethods) || (config.BodyStrategy == nil && r.GetBody != nil) {
+		first := true
+		return func() (io.ReadCloser, error) {
+			if first || r.GetBody == nil {
+				first = false
+				return r.Body, nil
+			}
+			return r.GetBody()
+		}, nil
+	}
+	strategy := config.BodyStrategy
+	if strategy == nil {
+		strategy = defaultBodyStrategy
+	}
+	getBody, err := strategy(r)
+	if err != nil {
+		return nil, err
+	}
+	return func() (io.ReadCloser, error) {
+		return getBody(), nil
+	}, nil
+}
+
+// requestMethod returns method of provided request, taking into account that
+// empty method means GET.
+func requestMethod(r *http.Request) string {
+	if r.Method == "" {
+		return http.MethodGet
+	}
+	return r.Method
+}
+
+// wait blocks for provided duration or until provided context is done,
+// whichever happens first. If context is done, its error is returned.
+func wait(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// drainBody reads (up to a limit) and closes body of provided response,
+// so that underlying connection can be reused.
+func drainBody(resp *http.Response) {
+	if resp == nil || resp.Body == nil {
+		return
 	}
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxDrainBytes))
+	_ = resp.Body.Close()
 }
 
 func stringInSlice(s string, in []string) bool {
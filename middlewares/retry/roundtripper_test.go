@@ -2,12 +2,15 @@ package retry
 
 import (
 	"net/http"
+	"strconv"
 	"testing"
 	"time"
 
 	"context"
 	"errors"
 	"io"
+	"reflect"
+	"strings"
 
 	"github.com/delicb/kioto/cliware"
 )
@@ -110,3 +113,240 @@ func TestRetryTransport_RoundTrip(t *testing.T) {
 		}
 	}
 }
+
+type trackingBody struct {
+	io.Reader
+	closed bool
+}
+
+func (b *trackingBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+type sequenceRoundTripper struct {
+	responses []*http.Response
+	calls     int
+}
+
+func (rt *sequenceRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp := rt.responses[rt.calls]
+	rt.calls++
+	return resp, nil
+}
+
+func TestRetryTransport_RoundTripContextCanceled(t *testing.T) {
+	mock := &mockRoundTripper{err: errors.New("my error")}
+	transport := NewRetryTransport(mock)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := cliware.EmptyRequest().WithContext(ctx)
+	req = req.WithContext(setRetryTimes(req.Context(), 5))
+	req = req.WithContext(setBackoff(req.Context(), ConstantBackoff(time.Hour)))
+
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := transport.RoundTrip(req)
+	if err != context.Canceled {
+		t.Errorf("Wrong error. Got: %v, expected: %v.", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Retry did not stop on canceled context, took: %s.", elapsed)
+	}
+	if mock.calledCount != 1 {
+		t.Errorf("Wrong number of calls. Got: %d, expected: 1.", mock.calledCount)
+	}
+}
+
+func TestRetryTransport_RoundTripDrainsDiscardedResponses(t *testing.T) {
+	bodies := []*trackingBody{
+		{Reader: strings.NewReader("first")},
+		{Reader: strings.NewReader("second")},
+		{Reader: strings.NewReader("third")},
+	}
+	mock := &sequenceRoundTripper{}
+	for _, b := range bodies {
+		mock.responses = append(mock.responses, &http.Response{StatusCode: 500, Body: b})
+	}
+	transport := NewRetryTransport(mock)
+
+	req := cliware.EmptyRequest()
+	req = req.WithContext(setRetryTimes(req.Context(), 2))
+	req = req.WithContext(setClassifier(req.Context(), On500PlusClassifier))
+	req = req.WithContext(setBackoff(req.Context(), ConstantBackoff(time.Millisecond)))
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if resp.Body != bodies[2] {
+		t.Error("Expected response of last attempt to be returned.")
+	}
+	for i, b := range bodies[:2] {
+		if !b.closed {
+			t.Errorf("Body of discarded response %d not closed.", i)
+		}
+	}
+	if bodies[2].closed {
+		t.Error("Body of returned response should not be closed.")
+	}
+}
+
+func TestRetryTransport_RoundTripHooks(t *testing.T) {
+	mock := &mockRoundTripper{err: errors.New("my error")}
+	transport := NewRetryTransport(mock)
+
+	var attempts []int
+	var delays []time.Duration
+	hook := func(attempt int, resp *http.Response, err error, delay time.Duration) {
+		if err == nil {
+			t.Error("Expected error to be passed to hook.")
+		}
+		attempts = append(attempts, attempt)
+		delays = append(delays, delay)
+	}
+
+	req := cliware.EmptyRequest()
+	req = req.WithContext(setRetryTimes(req.Context(), 2))
+	req = req.WithContext(setBackoff(req.Context(), LinearBackoff(time.Millisecond, time.Second)))
+	req = req.WithContext(addRetryHook(req.Context(), hook))
+
+	if _, err := transport.RoundTrip(req); err == nil {
+		t.Error("Expected error, got nil.")
+	}
+	if !reflect.DeepEqual(attempts, []int{1, 2}) {
+		t.Errorf("Wrong attempts passed to hook. Got: %v, expected: [1 2].", attempts)
+	}
+	if !reflect.DeepEqual(delays, []time.Duration{time.Millisecond, 2 * time.Millisecond}) {
+		t.Errorf("Wrong delays passed to hook. Got: %v.", delays)
+	}
+}
+
+type headerRoundTripper struct {
+	headers []string
+}
+
+func (rt *headerRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	rt.headers = append(rt.headers, r.Header.Get("X-Attempt"))
+	return nil, errors.New("my error")
+}
+
+func TestRetryTransport_RoundTripAttemptHooks(t *testing.T) {
+	mock := &headerRoundTripper{}
+	transport := NewRetryTransport(mock)
+
+	var attempts []int
+	hook := func(attempt int, req *http.Request) {
+		attempts = append(attempts, attempt)
+		req.Header.Set("X-Attempt", strconv.Itoa(attempt))
+	}
+
+	req := cliware.EmptyRequest()
+	req = req.WithContext(setRetryTimes(req.Context(), 2))
+	req = req.WithContext(setBackoff(req.Context(), ConstantBackoff(time.Millisecond)))
+	req = req.WithContext(addAttemptHook(req.Context(), hook))
+
+	if _, err := transport.RoundTrip(req); err == nil {
+		t.Error("Expected error, got nil.")
+	}
+	if !reflect.DeepEqual(attempts, []int{1, 2, 3}) {
+		t.Errorf("Wrong attempts passed to hook. Got: %v, expected: [1 2 3].", attempts)
+	}
+	if !reflect.DeepEqual(mock.headers, []string{"1", "2", "3"}) {
+		t.Errorf("Wrong headers sent. Got: %v, expected: [1 2 3].", mock.headers)
+	}
+	if req.Header.Get("X-Attempt") != "" {
+		t.Error("Attempt hook modified original request headers.")
+	}
+}
+
+func TestRetryTransport_RoundTripHonorRetryAfter(t *testing.T) {
+	for _, data := range []struct {
+		RetryAfter  string
+		MaxDuration time.Duration
+		Expected    time.Duration
+	}{
+		{RetryAfter: "", MaxDuration: time.Minute, Expected: time.Millisecond},
+		{RetryAfter: "0", MaxDuration: time.Minute, Expected: 0},
+		{RetryAfter: "3600", MaxDuration: 5 * time.Millisecond, Expected: 5 * time.Millisecond},
+	} {
+		header := http.Header{}
+		if data.RetryAfter != "" {
+			header.Set("Retry-After", data.RetryAfter)
+		}
+		mock := &mockRoundTripper{response: &http.Response{StatusCode: 429, Header: header}}
+		transport := NewRetryTransport(mock)
+
+		var delay time.Duration
+		req := cliware.EmptyRequest()
+		req = req.WithContext(setRetryTimes(req.Context(), 1))
+		req = req.WithContext(setClassifier(req.Context(), RateLimitedClassifier))
+		req = req.WithContext(setBackoff(req.Context(), ConstantBackoff(time.Millisecond)))
+		req = req.WithContext(setMaxDuration(req.Context(), data.MaxDuration))
+		req = req.WithContext(setHonorRetryAfter(req.Context(), true))
+		req = req.WithContext(addRetryHook(req.Context(), func(_ int, _ *http.Response, _ error, d time.Duration) {
+			delay = d
+		}))
+
+		if _, err := transport.RoundTrip(req); err != nil {
+			t.Error("Unexpected error:", err)
+		}
+		// delay capped by max duration is reduced by time spent so far, so
+		// allow some tolerance
+		if delay > data.Expected || delay < data.Expected-time.Millisecond {
+			t.Errorf("Wrong delay for Retry-After %q. Got: %s, expected: %s.", data.RetryAfter, delay, data.Expected)
+		}
+	}
+}
+
+type bodyRecordingRoundTripper struct {
+	bodies []io.ReadCloser
+}
+
+func (rt *bodyRecordingRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	rt.bodies = append(rt.bodies, r.Body)
+	return nil, errors.New("my error")
+}
+
+func TestRetryTransport_RoundTripBody(t *testing.T) {
+	strategyCalled := false
+	strategy := BodyStrategy(func(r *http.Request) (func() io.ReadCloser, error) {
+		strategyCalled = true
+		return nil, errors.New("strategy called")
+	})
+
+	// body of request that is not retried is sent as is
+	mock := &bodyRecordingRoundTripper{}
+	body := &trackingBody{Reader: strings.NewReader("body")}
+	req := cliware.EmptyRequest()
+	req.Method = "POST"
+	req.Body = body
+	req = req.WithContext(setBodyStrategy(req.Context(), strategy))
+	_, _ = NewRetryTransport(mock).RoundTrip(req)
+	if strategyCalled {
+		t.Error("Body strategy called for request that is not retried.")
+	}
+	if len(mock.bodies) != 1 || mock.bodies[0] != body {
+		t.Errorf("Wrong bodies sent: %v.", mock.bodies)
+	}
+
+	// GetBody is used for retries if body strategy is not set
+	mock = &bodyRecordingRoundTripper{}
+	getBodyCalls := 0
+	req = cliware.EmptyRequest()
+	req.Body = body
+	req.GetBody = func() (io.ReadCloser, error) {
+		getBodyCalls++
+		return &trackingBody{Reader: strings.NewReader("body")}, nil
+	}
+	req = req.WithContext(setRetryTimes(req.Context(), 2))
+	req = req.WithContext(setBackoff(req.Context(), ConstantBackoff(time.Millisecond)))
+	_, _ = NewRetryTransport(mock).RoundTrip(req)
+	if len(mock.bodies) != 3 || mock.bodies[0] != body {
+		t.Errorf("Wrong bodies sent: %v.", mock.bodies)
+	}
+	if getBodyCalls != 2 {
+		t.Errorf("Wrong number of GetBody calls. Got: %d, expected: 2.", getBodyCalls)
+	}
+}
@@ -0,0 +1,226 @@
+// Package timing contains middleware that records duration of phases of HTTP
+// request (DNS lookup, connect, TLS handshake, time to first byte) using
+// net/http/httptrace.
+//
+// Phases are recorded per attempt, so when request is retried (see retry
+// package) each attempt has its own timings. Recorded timings are available
+// from request context with FromContext, or as kioto.Response.Timings.
+package timing
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	c "github.com/delicb/kioto/cliware"
+	"github.com/delicb/kioto/middlewares/retry"
+)
+
+type timingsKeyType int
+
+var timingsKey timingsKeyType
+
+// Attempt holds timings of one attempt of sending request.
+type Attempt struct {
+	// Start is time when attempt started (when connection was requested).
+	Start time.Time
+	// DNS is duration of DNS lookup, zero if there was no lookup.
+	DNS time.Duration
+	// Connect is duration of establishing TCP connection, zero if existing
+	// connection was reused.
+	Connect time.Duration
+	// TLS is duration of TLS handshake, zero if there was no handshake.
+	TLS time.Duration
+	// TTFB (time to first byte) is duration from start of attempt until
+	// first byte of response was received.
+	TTFB time.Duration
+	// Total is duration of whole attempt, until response or error was
+	// received.
+	Total time.Duration
+	// ConnReused reports if connection was reused from previous requests.
+	ConnReused bool
+	// Err is error with which attempt failed, if any.
+	Err error
+
+	dnsStart, connectStart, tlsStart time.Time
+	done                             bool
+}
+
+// Timings holds timings of all attempts of one request.
+type Timings struct {
+	mu       sync.Mutex
+	start    time.Time
+	total    time.Duration
+	attempts []*Attempt
+	now      func() time.Time
+}
+
+// Attempts returns timings of all attempts, in order in which they were
+// made. Returned values must not be modified.
+func (t *Timings) Attempts() []*Attempt {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	attempts := make([]*Attempt, len(t.attempts))
+	copy(attempts, t.attempts)
+	return attempts
+}
+
+// Last returns timings of last attempt or nil if there were no attempts.
+func (t *Timings) Last() *Attempt {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.attempts) == 0 {
+		return nil
+	}
+	return t.attempts[len(t.attempts)-1]
+}
+
+// Total returns duration of whole request, including all attempts and
+// waiting between them.
+func (t *Timings) Total() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.total
+}
+
+// FromContext returns timings recorded for request with provided context,
+// or nil if Trace middleware was not used.
+func FromContext(ctx context.Context) *Timings {
+	if ctx == nil {
+		return nil
+	}
+	timings, _ := ctx.Value(timingsKey).(*Timings)
+	return timings
+}
+
+// Trace records timings of request phases. Since total duration is measured
+// until response is returned to this middleware, it should be executed after
+// other middlewares, e.g. added with Client.UsePost.
+func Trace() c.Middleware {
+	return c.MiddlewareFunc(func(next c.Handler) c.Handler {
+		return c.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+			timings := &Timings{now: time.Now}
+			timings.start = timings.now()
+
+			ctx := context.WithValue(req.Context(), timingsKey, timings)
+			ctx = httptrace.WithClientTrace(ctx, timings.clientTrace())
+			handler := retry.OnRetry(func(attempt int, resp *http.Response, err error, delay time.Duration) {
+				timings.finish(err)
+			}).Exec(next)
+
+			resp, err := handler.Handle(req.WithContext(ctx))
+			timings.finish(err)
+
+			timings.mu.Lock()
+			timings.total = timings.now().Sub(timings.start)
+			timings.mu.Unlock()
+			return resp, err
+		})
+	})
+}
+
+// startAttempt begins new attempt, unless there is attempt in progress already.
+func (t *Timings) startAttempt() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.inProgress() == nil {
+		t.attempts = append(t.attempts, &Attempt{Start: t.now()})
+	}
+}
+
+// inProgress returns attempt in progress or nil if there is none. Caller
+// must hold the lock.
+func (t *Timings) inProgress() *Attempt {
+	if len(t.attempts) == 0 {
+		return nil
+	}
+	if last := t.attempts[len(t.attempts)-1]; !last.done {
+		return last
+	}
+	return nil
+}
+
+// finish marks attempt in progress as done.
+func (t *Timings) finish(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	attempt := t.inProgress()
+	if attempt == nil {
+		return
+	}
+	attempt.done = true
+	attempt.Total = t.now().Sub(attempt.Start)
+	attempt.Err = err
+}
+
+// update calls provided function with attempt in progress, under lock.
+// Events that happen when there is no attempt in progress (e.g. parallel
+// dial that finished after response was received) are ignored.
+func (t *Timings) update(f func(now time.Time, a *Attempt)) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if attempt := t.inProgress(); attempt != nil {
+		f(t.now(), attempt)
+	}
+}
+
+func (t *Timings) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GetConn: func(string) {
+			t.startAttempt()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.update(func(_ time.Time, a *Attempt) {
+				a.ConnReused = info.Reused
+			})
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.update(func(now time.Time, a *Attempt) {
+				a.dnsStart = now
+			})
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.update(func(now time.Time, a *Attempt) {
+				if !a.dnsStart.IsZero() {
+					a.DNS = now.Sub(a.dnsStart)
+				}
+			})
+		},
+		ConnectStart: func(network, addr string) {
+			t.update(func(now time.Time, a *Attempt) {
+				// with multiple addresses, connecting happens in parallel,
+				// first start is used
+				if a.connectStart.IsZero() {
+					a.connectStart = now
+				}
+			})
+		},
+		ConnectDone: func(network, addr string, err error) {
+			t.update(func(now time.Time, a *Attempt) {
+				if err == nil && a.Connect == 0 && !a.connectStart.IsZero() {
+					a.Connect = now.Sub(a.connectStart)
+				}
+			})
+		},
+		TLSHandshakeStart: func() {
+			t.update(func(now time.Time, a *Attempt) {
+				a.tlsStart = now
+			})
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.update(func(now time.Time, a *Attempt) {
+				if !a.tlsStart.IsZero() {
+					a.TLS = now.Sub(a.tlsStart)
+				}
+			})
+		},
+		GotFirstResponseByte: func() {
+			t.update(func(now time.Time, a *Attempt) {
+				a.TTFB = now.Sub(a.Start)
+			})
+		},
+	}
+}
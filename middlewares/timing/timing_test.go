@@ -0,0 +1,107 @@
+package timing_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/delicb/kioto"
+	"github.com/delicb/kioto/cliware"
+	"github.com/delicb/kioto/middlewares/retry"
+	"github.com/delicb/kioto/middlewares/timing"
+)
+
+func TestTrace(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client := kioto.New(kioto.HTTPClient(server.Client()), kioto.PostMiddlewares(timing.Trace()))
+	for i := 0; i < 2; i++ {
+		resp, err := client.Request().URL(server.URL).Send()
+		require.NoError(t, err)
+		// body has to be read fully for connection to be reused
+		_, _ = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		require.NotNil(t, resp.Timings)
+		attempts := resp.Timings.Attempts()
+		require.Len(t, attempts, 1)
+		attempt := attempts[0]
+		assert.True(t, attempt.TTFB >= 10*time.Millisecond, "wrong TTFB: %s", attempt.TTFB)
+		assert.True(t, attempt.Total >= attempt.TTFB)
+		assert.True(t, resp.Timings.Total() >= attempt.Total)
+		assert.NoError(t, attempt.Err)
+		if i == 0 {
+			assert.False(t, attempt.ConnReused)
+			assert.True(t, attempt.Connect > 0, "connect not recorded")
+			assert.True(t, attempt.TLS > 0, "TLS handshake not recorded")
+		} else {
+			assert.True(t, attempt.ConnReused)
+			assert.Equal(t, time.Duration(0), attempt.Connect)
+			assert.Equal(t, time.Duration(0), attempt.TLS)
+		}
+	}
+}
+
+func TestTraceRetries(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client := kioto.New(kioto.PostMiddlewares(timing.Trace()))
+	resp, err := client.Request().URL(server.URL).Use(
+		retry.Times(2),
+		retry.SetClassifier(retry.On500PlusClassifier),
+		retry.SetBackoffStrategy(retry.ConstantBackoff(20*time.Millisecond)),
+	).Send()
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	attempts := resp.Timings.Attempts()
+	require.Len(t, attempts, 3)
+	for i, attempt := range attempts {
+		assert.True(t, attempt.Total > 0, "attempt %d not finished", i)
+		if i > 0 {
+			assert.True(t, attempt.Start.Sub(attempts[i-1].Start) >= 20*time.Millisecond, "backoff included in attempt %d", i)
+		}
+	}
+	assert.Equal(t, attempts[2], resp.Timings.Last())
+	assert.True(t, resp.Timings.Total() >= 40*time.Millisecond)
+}
+
+func TestTraceError(t *testing.T) {
+	client := kioto.New(kioto.DisableRetry(), kioto.PostMiddlewares(timing.Trace()))
+	resp, err := client.Request().URL("http://127.0.0.1:1/").Send()
+	require.Error(t, err)
+	assert.Nil(t, resp.Timings, "timings available without response")
+}
+
+func TestFromContext(t *testing.T) {
+	assert.Nil(t, timing.FromContext(context.Background()))
+
+	var timings *timing.Timings
+	handler := cliware.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		timings = timing.FromContext(req.Context())
+		return nil, nil
+	})
+	_, err := timing.Trace().Exec(handler).Handle(cliware.EmptyRequest())
+	require.NoError(t, err)
+	require.NotNil(t, timings)
+	assert.Nil(t, timings.Last(), "attempt recorded without connection")
+}
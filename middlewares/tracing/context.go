@@ -0,0 +1,142 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// IsValid reports if trace ID is valid (not all zeros).
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+// String returns hex encoded trace ID.
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanID identifies a span.
+type SpanID [8]byte
+
+// IsValid reports if span ID is valid (not all zeros).
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// String returns hex encoded span ID.
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// FlagSampled is trace flag that indicates that caller may have recorded
+// trace data.
+const FlagSampled byte = 0x01
+
+// SpanContext is part of span that is propagated to other services, as
+// defined by W3C Trace Context.
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte
+	TraceState string
+}
+
+// IsValid reports if span context has valid trace and span IDs.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent returns value of traceparent header for span context.
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+// ErrInvalidTraceparent is returned when traceparent header can not be parsed.
+var ErrInvalidTraceparent = errors.New("tracing: invalid traceparent")
+
+// ParseTraceparent parses value of traceparent header. Trace state is not
+// part of traceparent, so it is not set on returned span context.
+func ParseTraceparent(value string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, ErrInvalidTraceparent
+	}
+	// version 00 has exactly four parts, future versions may have more
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, ErrInvalidTraceparent
+	}
+	if !decodeHex(sc.TraceID[:], parts[1]) || !decodeHex(sc.SpanID[:], parts[2]) {
+		return sc, ErrInvalidTraceparent
+	}
+	var flags [1]byte
+	if !decodeHex(flags[:], parts[3]) {
+		return sc, ErrInvalidTraceparent
+	}
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return sc, ErrInvalidTraceparent
+	}
+	return sc, nil
+}
+
+// Extract returns span context from traceparent and tracestate headers, e.g.
+// of incoming server request, so that outgoing requests can continue trace.
+func Extract(header http.Header) (SpanContext, error) {
+	sc, err := ParseTraceparent(header.Get(TraceparentHeader))
+	if err != nil {
+		return sc, err
+	}
+	sc.TraceState = strings.Join(header.Values(TracestateHeader), ",")
+	return sc, nil
+}
+
+// decodeHex decodes lowercase hex string that has to fill destination exactly.
+func decodeHex(dst []byte, s string) bool {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
+
+type spanContextKeyType int
+
+var spanContextKey spanContextKeyType
+
+// ContextWithSpanContext returns context with provided span context. Tracing
+// middleware uses it as parent of request span.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey, sc)
+}
+
+// SpanContextFromContext returns span context from provided context. If
+// there is none, invalid (zero) span context is returned.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(spanContextKey).(SpanContext)
+	return sc
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
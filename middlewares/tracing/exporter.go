@@ -0,0 +1,126 @@
+package tracing
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Span kinds.
+const (
+	KindClient   = "client"
+	KindInternal = "internal"
+)
+
+// Span statuses.
+const (
+	StatusUnset = "unset"
+	StatusOK    = "ok"
+	StatusError = "error"
+)
+
+// Span holds information about one traced operation.
+type Span struct {
+	Name       string                 `json:"name"`
+	Kind       string                 `json:"kind"`
+	TraceID    string                 `json:"trace_id"`
+	SpanID     string                 `json:"span_id"`
+	ParentID   string                 `json:"parent_id,omitempty"`
+	TraceState string                 `json:"trace_state,omitempty"`
+	Start      time.Time              `json:"start"`
+	End        time.Time              `json:"end"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	Status     string                 `json:"status"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+// Duration returns duration of span.
+func (s *Span) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// Exporter receives finished spans. Implementations must be safe for
+// concurrent use.
+type Exporter interface {
+	Export(span *Span) error
+}
+
+// InMemoryExporter keeps exported spans in memory. It is intended for tests.
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+// NewInMemoryExporter creates empty InMemoryExporter.
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+// Export is implementation of Exporter interface.
+func (e *InMemoryExporter) Export(span *Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+	return nil
+}
+
+// Spans returns all exported spans, in order in which they were exported.
+func (e *InMemoryExporter) Spans() []*Span {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	spans := make([]*Span, len(e.spans))
+	copy(spans, e.spans)
+	return spans
+}
+
+// Reset removes all exported spans.
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
+
+// JSONLinesExporter writes every span as one line of JSON.
+type JSONLinesExporter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+// NewJSONLinesExporter creates exporter that writes spans to provided writer.
+func NewJSONLinesExporter(w io.Writer) *JSONLinesExporter {
+	return &JSONLinesExporter{w: w}
+}
+
+// NewFileExporter creates exporter that appends spans to file on provided
+// path, creating it if needed. Close should be called when exporter is not
+// needed any more.
+func NewFileExporter(path string) (*JSONLinesExporter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLinesExporter{w: file, closer: file}, nil
+}
+
+// Export is implementation of Exporter interface.
+func (e *JSONLinesExporter) Export(span *Span) error {
+	data, err := json.Marshal(span)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err = e.w.Write(append(data, '\n'))
+	return err
+}
+
+// Close closes underlying file, if exporter was created with NewFileExporter.
+func (e *JSONLinesExporter) Close() error {
+	if e.closer == nil {
+		return nil
+	}
+	return e.closer.Close()
+}
@@ -0,0 +1,220 @@
+// Package tracing contains middleware for W3C Trace Context propagation and
+// recording of client spans.
+//
+// For every request, span is started as child of span context found in
+// request context (see ContextWithSpanContext), or as root of new trace.
+// Every attempt made by retry transport (see retry package) is recorded as
+// separate client span, child of request span, and its span context is sent
+// in traceparent and tracestate headers. Finished spans are sent to Exporter.
+package tracing
+
+import (
+	"net"
+	"net/http"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	c "github.com/delicb/kioto/cliware"
+	"github.com/delicb/kioto/middlewares/retry"
+)
+
+// Header names used for propagation.
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+// Option configures Tracer.
+type Option func(*Tracer)
+
+// SpanName sets function that determines name of spans for request. Default
+// name is HTTP method (e.g. "GET"), as recommended by semantic conventions,
+// since full URLs have too high cardinality.
+func SpanName(name func(req *http.Request) string) Option {
+	return func(t *Tracer) {
+		t.name = name
+	}
+}
+
+// ErrorHandler sets function that is called when exporter fails to export
+// span. By default, export errors are ignored.
+func ErrorHandler(handler func(err error)) Option {
+	return func(t *Tracer) {
+		t.onError = handler
+	}
+}
+
+// Tracer is middleware that propagates trace context and records spans.
+type Tracer struct {
+	exporter Exporter
+	name     func(req *http.Request) string
+	onError  func(err error)
+	now      func() time.Time
+}
+
+// New creates Tracer that sends finished spans to provided exporter.
+func New(exporter Exporter, options ...Option) *Tracer {
+	t := &Tracer{
+		exporter: exporter,
+		name:     func(req *http.Request) string { return req.Method },
+		onError:  func(error) {},
+		now:      time.Now,
+	}
+	for _, opt := range options {
+		opt(t)
+	}
+	return t
+}
+
+// Exec is implementation of cliware.Middleware interface.
+//
+// Request span has kind KindInternal if retry transport reported attempts
+// (attempts are then client spans) and KindClient otherwise.
+func (t *Tracer) Exec(next c.Handler) c.Handler {
+	return c.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		parent := SpanContextFromContext(req.Context())
+		sc := SpanContext{
+			TraceID:    parent.TraceID,
+			SpanID:     newSpanID(),
+			Flags:      parent.Flags,
+			TraceState: parent.TraceState,
+		}
+		if !parent.IsValid() {
+			sc.TraceID = newTraceID()
+			sc.Flags = FlagSampled
+		}
+
+		name := t.name(req)
+		span := t.newSpan(name, sc, req)
+		if parent.IsValid() {
+			span.ParentID = parent.SpanID.String()
+		}
+
+		var (
+			mu       sync.Mutex
+			attempts int
+			current  *Span
+		)
+		onAttempt := func(attempt int, r *http.Request) {
+			attemptSC := sc
+			attemptSC.SpanID = newSpanID()
+			attemptSpan := t.newSpan(name, attemptSC, r)
+			attemptSpan.ParentID = sc.SpanID.String()
+			if attempt > 1 {
+				attemptSpan.Attributes["http.request.resend_count"] = attempt - 1
+			}
+			inject(r.Header, attemptSC)
+
+			mu.Lock()
+			defer mu.Unlock()
+			attempts++
+			current = attemptSpan
+		}
+		onRetry := func(attempt int, resp *http.Response, err error, delay time.Duration) {
+			mu.Lock()
+			finished := current
+			current = nil
+			mu.Unlock()
+			if finished != nil {
+				t.finish(finished, resp, err)
+			}
+		}
+
+		req = req.WithContext(ContextWithSpanContext(req.Context(), sc))
+		// used if request is not sent through retry transport
+		inject(req.Header, sc)
+
+		handler := retry.OnAttempt(onAttempt).Exec(retry.OnRetry(onRetry).Exec(next))
+		resp, err := handler.Handle(req)
+
+		mu.Lock()
+		last := current
+		span.Attributes["kioto.attempts"] = attempts
+		if attempts > 0 {
+			span.Kind = KindInternal
+		}
+		mu.Unlock()
+		if last != nil {
+			t.finish(last, resp, err)
+		}
+		t.finish(span, resp, err)
+		return resp, err
+	})
+}
+
+func (t *Tracer) newSpan(name string, sc SpanContext, req *http.Request) *Span {
+	span := &Span{
+		Name:       name,
+		Kind:       KindClient,
+		TraceID:    sc.TraceID.String(),
+		SpanID:     sc.SpanID.String(),
+		TraceState: sc.TraceState,
+		Start:      t.now(),
+		Attributes: map[string]interface{}{
+			"http.request.method": req.Method,
+		},
+		Status: StatusUnset,
+	}
+	if req.URL != nil {
+		span.Attributes["url.full"] = req.URL.Redacted()
+		host, port := req.URL.Hostname(), req.URL.Port()
+		if host != "" {
+			span.Attributes["server.address"] = host
+		}
+		if port == "" {
+			switch req.URL.Scheme {
+			case "http":
+				port = "80"
+			case "https":
+				port = "443"
+			}
+		}
+		if p, err := strconv.Atoi(port); err == nil {
+			span.Attributes["server.port"] = p
+		}
+	}
+	return span
+}
+
+// finish ends span with results of request and exports it.
+func (t *Tracer) finish(span *Span, resp *http.Response, err error) {
+	span.End = t.now()
+	switch {
+	case err != nil:
+		span.Status = StatusError
+		span.Error = err.Error()
+		span.Attributes["error.type"] = errorType(err)
+	case resp != nil:
+		span.Attributes["http.response.status_code"] = resp.StatusCode
+		if resp.StatusCode >= 400 {
+			span.Status = StatusError
+			span.Attributes["error.type"] = strconv.Itoa(resp.StatusCode)
+		} else {
+			span.Status = StatusOK
+		}
+	}
+	if exportErr := t.exporter.Export(span); exportErr != nil {
+		t.onError(exportErr)
+	}
+}
+
+// errorType returns low cardinality description of error, as recommended
+// by semantic conventions for error.type attribute.
+func errorType(err error) string {
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return "timeout"
+	}
+	return reflect.TypeOf(err).String()
+}
+
+// inject sets trace context headers for provided span context.
+func inject(header http.Header, sc SpanContext) {
+	header.Set(TraceparentHeader, sc.Traceparent())
+	if sc.TraceState != "" {
+		header.Set(TracestateHeader, sc.TraceState)
+	} else {
+		header.Del(TracestateHeader)
+	}
+}
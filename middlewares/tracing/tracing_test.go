@@ -0,0 +1,217 @@
+package tracing_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/delicb/kioto"
+	"github.com/delicb/kioto/cliware"
+	"github.com/delicb/kioto/middlewares/retry"
+	"github.com/delicb/kioto/middlewares/tracing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	sc, err := tracing.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.NoError(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.Equal(t, tracing.FlagSampled, sc.Flags)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sc.Traceparent())
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+	} {
+		_, err := tracing.ParseTraceparent(invalid)
+		assert.Equal(t, tracing.ErrInvalidTraceparent, err, invalid)
+	}
+
+	_, err = tracing.ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-future")
+	assert.NoError(t, err, "future versions may have more fields")
+}
+
+func TestExtract(t *testing.T) {
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	header.Add("tracestate", "a=1")
+	header.Add("tracestate", "b=2")
+	sc, err := tracing.Extract(header)
+	require.NoError(t, err)
+	assert.Equal(t, "a=1,b=2", sc.TraceState)
+	assert.Equal(t, byte(0), sc.Flags)
+}
+
+type recordingServer struct {
+	mu      sync.Mutex
+	headers []http.Header
+	calls   int32
+	fail    int32
+}
+
+func (s *recordingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.headers = append(s.headers, r.Header.Clone())
+	s.mu.Unlock()
+	if atomic.AddInt32(&s.calls, 1) <= s.fail {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok"))
+}
+
+func TestTracerRetries(t *testing.T) {
+	handler := &recordingServer{fail: 2}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	exporter := tracing.NewInMemoryExporter()
+	client := kioto.New(kioto.PostMiddlewares(tracing.New(exporter)))
+
+	parent, err := tracing.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.NoError(t, err)
+	parent.TraceState = "vendor=value"
+	ctx := tracing.ContextWithSpanContext(context.Background(), parent)
+
+	resp, err := client.Request().WithContext(ctx).URL(server.URL+"/path").Use(
+		retry.Times(3),
+		retry.SetClassifier(retry.On500PlusClassifier),
+		retry.SetBackoffStrategy(retry.ConstantBackoff(time.Millisecond)),
+	).Send()
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	spans := exporter.Spans()
+	require.Len(t, spans, 4, "expected three attempts and request span")
+	request := spans[3]
+	assert.Equal(t, tracing.KindInternal, request.Kind)
+	assert.Equal(t, "GET", request.Name)
+	assert.Equal(t, parent.TraceID.String(), request.TraceID)
+	assert.Equal(t, parent.SpanID.String(), request.ParentID)
+	assert.Equal(t, tracing.StatusOK, request.Status)
+	assert.Equal(t, 3, request.Attributes["kioto.attempts"])
+	assert.Equal(t, 200, request.Attributes["http.response.status_code"])
+
+	require.Len(t, handler.headers, 3)
+	for i, attempt := range spans[:3] {
+		assert.Equal(t, tracing.KindClient, attempt.Kind)
+		assert.Equal(t, parent.TraceID.String(), attempt.TraceID)
+		assert.Equal(t, request.SpanID, attempt.ParentID)
+		assert.Equal(t, "00-"+attempt.TraceID+"-"+attempt.SpanID+"-01", handler.headers[i].Get("traceparent"))
+		assert.Equal(t, "vendor=value", handler.headers[i].Get("tracestate"))
+		assert.Equal(t, server.URL+"/path", attempt.Attributes["url.full"])
+		assert.Equal(t, "127.0.0.1", attempt.Attributes["server.address"])
+		if i < 2 {
+			assert.Equal(t, tracing.StatusError, attempt.Status)
+			assert.Equal(t, 503, attempt.Attributes["http.response.status_code"])
+		} else {
+			assert.Equal(t, tracing.StatusOK, attempt.Status)
+		}
+		if i == 0 {
+			assert.NotContains(t, attempt.Attributes, "http.request.resend_count")
+		} else {
+			assert.Equal(t, i, attempt.Attributes["http.request.resend_count"])
+		}
+		assert.False(t, attempt.End.Before(attempt.Start))
+	}
+}
+
+func TestTracerNewTrace(t *testing.T) {
+	var header http.Header
+	handler := cliware.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+		header = req.Header
+		return &http.Response{StatusCode: 404}, nil
+	})
+	exporter := tracing.NewInMemoryExporter()
+	req := cliware.EmptyRequest()
+	req.URL.Scheme = "https"
+	req.URL.Host = "example.com"
+	req.URL.User = url.UserPassword("user", "secret")
+	_, err := tracing.New(exporter, tracing.SpanName(func(r *http.Request) string {
+		return "custom"
+	})).Exec(handler).Handle(req)
+	require.NoError(t, err)
+
+	spans := exporter.Spans()
+	require.Len(t, spans, 1)
+	span := spans[0]
+	assert.Equal(t, tracing.KindClient, span.Kind, "request span is client span without attempts")
+	assert.Equal(t, "custom", span.Name)
+	assert.Empty(t, span.ParentID)
+	assert.Equal(t, tracing.StatusError, span.Status)
+	assert.Equal(t, "404", span.Attributes["error.type"])
+	assert.Equal(t, 443, span.Attributes["server.port"])
+	assert.NotContains(t, span.Attributes["url.full"], "secret")
+	assert.Equal(t, "00-"+span.TraceID+"-"+span.SpanID+"-01", header.Get("traceparent"))
+	assert.Empty(t, header.Get("tracestate"))
+}
+
+func TestTracerError(t *testing.T) {
+	exporter := tracing.NewInMemoryExporter()
+	client := kioto.New(kioto.DisableRetry(), kioto.PostMiddlewares(tracing.New(exporter)))
+	_, err := client.Request().URL("http://127.0.0.1:1/").Send()
+	require.Error(t, err)
+	spans := exporter.Spans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, tracing.StatusError, spans[0].Status)
+	assert.NotEmpty(t, spans[0].Error)
+	assert.NotEmpty(t, spans[0].Attributes["error.type"])
+}
+
+func TestJSONLinesExporter(t *testing.T) {
+	buff := &bytes.Buffer{}
+	exporter := tracing.NewJSONLinesExporter(buff)
+	require.NoError(t, exporter.Export(&tracing.Span{Name: "first", Status: tracing.StatusOK}))
+	require.NoError(t, exporter.Export(&tracing.Span{Name: "second", Status: tracing.StatusError}))
+	require.NoError(t, exporter.Close())
+
+	lines := strings.Split(strings.TrimSpace(buff.String()), "\n")
+	require.Len(t, lines, 2)
+	span := &tracing.Span{}
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), span))
+	assert.Equal(t, "second", span.Name)
+}
+
+func TestFileExporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kioto-tracing")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "spans.jsonl")
+
+	for i := 0; i < 2; i++ {
+		exporter, err := tracing.NewFileExporter(path)
+		require.NoError(t, err)
+		require.NoError(t, exporter.Export(&tracing.Span{Name: "span"}))
+		require.NoError(t, exporter.Close())
+	}
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(data), "\n"), "file not appended")
+}
+
+func TestInMemoryExporterReset(t *testing.T) {
+	exporter := tracing.NewInMemoryExporter()
+	require.NoError(t, exporter.Export(&tracing.Span{}))
+	exporter.Reset()
+	assert.Empty(t, exporter.Spans())
+}
@@ -2,6 +2,7 @@
 package url
 
 import (
+	"context"
 	"net/http"
 	"net/url"
 	"strings"
@@ -60,24 +61,60 @@ func PathPrefix(path string) c.Middleware {
 	})
 }
 
-// Param replaces one or multiple URL parameters with given value.
+type routeTemplateKeyType int
+
+var routeTemplateKey routeTemplateKeyType
+
+// WithRouteTemplate returns context with provided route template (path
+// before parameters are replaced, e.g. "/users/:id").
+func WithRouteTemplate(ctx context.Context, template string) context.Context {
+	return context.WithValue(ctx, routeTemplateKey, template)
+}
+
+// RouteTemplate returns route template of request with provided context. It
+// is set by Param and Params middlewares (or WithRouteTemplate) and it can
+// be used where path with low cardinality is needed, e.g. in metrics.
+// Empty string is returned if route template is not set.
+func RouteTemplate(ctx context.Context) string {
+	template, _ := ctx.Value(routeTemplateKey).(string)
+	return template
+}
+
+// Param replaces one or multiple URL parameters with given value. Path
+// before replacement is stored as route template (see RouteTemplate).
 func Param(key, value string) c.Middleware {
-	return c.RequestProcessor(func(req *http.Request) error {
-		req.URL.Path = replace(req.URL.Path, key, value)
-		return nil
+	return c.MiddlewareFunc(func(next c.Handler) c.Handler {
+		return c.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+			req = withRouteTemplate(req)
+			req.URL.Path = replace(req.URL.Path, key, value)
+			return next.Handle(req)
+		})
 	})
 }
 
-// Params replaces all provided parameters in URL with mapped values.
+// Params replaces all provided parameters in URL with mapped values. Path
+// before replacement is stored as route template (see RouteTemplate).
 func Params(params map[string]string) c.Middleware {
-	return c.RequestProcessor(func(req *http.Request) error {
-		for k, v := range params {
-			req.URL.Path = replace(req.URL.Path, k, v)
-		}
-		return nil
+	return c.MiddlewareFunc(func(next c.Handler) c.Handler {
+		return c.HandlerFunc(func(req *http.Request) (*http.Response, error) {
+			req = withRouteTemplate(req)
+			for k, v := range params {
+				req.URL.Path = replace(req.URL.Path, k, v)
+			}
+			return next.Handle(req)
+		})
 	})
 }
 
+// withRouteTemplate stores current path of request as route template, unless
+// template is already set (by previous parameter replacement).
+func withRouteTemplate(req *http.Request) *http.Request {
+	if RouteTemplate(req.Context()) != "" {
+		return req
+	}
+	return req.WithContext(WithRouteTemplate(req.Context(), req.URL.Path))
+}
+
 func replace(str, key, value string) string {
 	return strings.Replace(str, ":"+key, value, -1)
 }
@@ -191,3 +191,29 @@ func TestParams(t *testing.T) {
 		}
 	}
 }
+
+func TestRouteTemplate(t *testing.T) {
+	var template string
+	handler := cliware.HandlerFunc(func(req *http.Request) (resp *http.Response, err error) {
+		template = url.RouteTemplate(req.Context())
+		return nil, nil
+	})
+	req := cliware.EmptyRequest()
+	req.URL.Path = "/users/:id/posts/:post"
+	chain := cliware.NewChain(
+		url.Param("id", "42"),
+		url.Params(map[string]string{"post": "7"}),
+	)
+	if _, err := chain.Exec(handler).Handle(req); err != nil {
+		t.Error("Unexpected error: ", err)
+	}
+	if template != "/users/:id/posts/:post" {
+		t.Errorf("Got wrong route template. Got: %s, expected: %s.", template, "/users/:id/posts/:post")
+	}
+	if req.URL.Path != "/users/42/posts/7" {
+		t.Errorf("Got wrong path. Got: %s, expected: %s.", req.URL.Path, "/users/42/posts/7")
+	}
+	if url.RouteTemplate(req.Context()) != "" {
+		t.Error("Route template set on original request context.")
+	}
+}
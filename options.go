@@ -6,6 +6,9 @@ import (
 	"time"
 
 	"github.com/delicb/kioto/cliware"
+	"github.com/delicb/kioto/codec"
+	"github.com/delicb/kioto/middlewares/cookies"
+	"github.com/delicb/kioto/middlewares/retry"
 )
 
 // ClientOption defines function type for modifying how doer instance behaves
@@ -19,6 +22,9 @@ type clientOptions struct {
 	httpClient      HTTPDoer
 	userAgent       UserAgent
 	timeout         time.Duration
+	retryBudget     *retry.Budget
+	codecs          map[string]codec.Codec
+	cookieJar       *cookies.Jar
 }
 
 // DisableRetry causes that HTTP requests will not be retried if they failed.
@@ -31,6 +37,42 @@ func DisableRetry() ClientOption {
 	}
 }
 
+// RetryBudget sets retry budget shared by all requests made with this client.
+// Budget limits retries to a ratio of successful requests, so that failing
+// dependency does not get overloaded by retries. When budget is exhausted,
+// requests fail with retry.ErrBudgetExhausted. It has no effect if DisableRetry
+// option is used.
+func RetryBudget(budget *retry.Budget) ClientOption {
+	return func(opts *clientOptions) {
+		opts.retryBudget = budget
+	}
+}
+
+// Codec registers codec for provided media type in client codec registry,
+// on top of codecs from codec.Default. Registered codecs are used by
+// Response.Decode and Request.Encode.
+func Codec(mediaType string, c codec.Codec) ClientOption {
+	return func(opts *clientOptions) {
+		if opts.codecs == nil {
+			opts.codecs = make(map[string]codec.Codec)
+		}
+		opts.codecs[mediaType] = c
+	}
+}
+
+// CookieJar sets cookie jar used by all requests made with this client.
+// Cookies received in responses are stored in jar and sent with subsequent
+// requests, so sessions are kept between requests. If doer is *http.Client,
+// copy of it with jar set as its Jar is used, so cookies set by redirect
+// responses are stored as well. Provided client is not changed, but Jar it
+// already has is not used by requests made with this client.
+// Other doers only see final responses, so jar is used as middleware.
+func CookieJar(jar *cookies.Jar) ClientOption {
+	return func(opts *clientOptions) {
+		opts.cookieJar = jar
+	}
+}
+
 // Middlewares sets default list of middlewares to be used for each request made
 // with this doer.
 func Middlewares(middlewares ...cliware.Middleware) ClientOption {
@@ -0,0 +1,170 @@
+// Package pagination provides iterator for walking paginated HTTP endpoints.
+//
+// Iterator sends the same kioto.Request multiple times, each time with
+// additional middlewares provided by Strategy that select next page. Built-in
+// strategies cover RFC 8288 Link header, cursor in JSON response, page number
+// and offset/limit based APIs. Custom strategies can be provided by
+// implementing Strategy interface.
+//
+// Usage:
+//
+//	it := pagination.New(client.Request().Get().URL("/users"), &pagination.LinkHeader{}, pagination.MaxPages(10))
+//	var users []User
+//	for it.Next(&users) {
+//		// process users from current page
+//	}
+//	if err := it.Err(); err != nil {
+//		// handle error
+//	}
+package pagination
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/delicb/kioto"
+	"github.com/delicb/kioto/cliware"
+	"github.com/delicb/kioto/middlewares/errors"
+)
+
+// Strategy defines how to request pages of paginated endpoint.
+type Strategy interface {
+	// First returns middleware that is applied to request for first page.
+	// Nil middleware means that request is sent unmodified.
+	First() cliware.Middleware
+	// Next inspects response for already fetched page and returns middleware
+	// that modifies request to fetch next page. Provided page is number of
+	// pages fetched so far (1 after first page). Nil middleware means that
+	// there are no more pages.
+	Next(page int, resp *http.Response, body []byte) (cliware.Middleware, error)
+}
+
+// Option configures Iterator.
+type Option func(*Iterator)
+
+// MaxPages sets maximum number of pages that iterator will fetch. Zero (default)
+// means no limit.
+func MaxPages(n int) Option {
+	return func(it *Iterator) {
+		it.maxPages = n
+	}
+}
+
+// Iterator walks through pages of paginated endpoint.
+type Iterator struct {
+	req      *kioto.Request
+	strategy Strategy
+	maxPages int
+
+	page int
+	next cliware.Middleware
+	done bool
+	err  error
+	resp *kioto.Response
+}
+
+// New creates Iterator that sends copies of provided request, modified by
+// provided strategy. Original request is never sent or modified.
+func New(req *kioto.Request, strategy Strategy, options ...Option) *Iterator {
+	it := &Iterator{
+		req:      req,
+		strategy: strategy,
+	}
+	for _, opt := range options {
+		opt(it)
+	}
+	return it
+}
+
+// Next fetches next page and decodes its JSON body into provided value. It
+// returns false when there are no more pages, maximum number of pages is
+// reached, request context is done or error occurs. Err should be checked
+// after Next returns false. Response with status code other than 2xx stops
+// iteration with *errors.HTTPError (see middlewares/errors package).
+func (it *Iterator) Next(v interface{}) bool {
+	if it.done || it.err != nil {
+		return false
+	}
+	if it.maxPages > 0 && it.page >= it.maxPages {
+		it.done = true
+		return false
+	}
+	if ctx := it.req.Context(); ctx != nil {
+		if err := ctx.Err(); err != nil {
+			it.err = err
+			return false
+		}
+	}
+
+	req := it.req.Clone()
+	m := it.next
+	if it.page == 0 {
+		m = it.strategy.First()
+	}
+	if m != nil {
+		req.Use(m)
+	}
+
+	resp, err := req.Send()
+	it.resp = resp
+	if err != nil {
+		it.err = err
+		return false
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	closeErr := resp.Body.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		it.err = err
+		return false
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		it.err = &errors.HTTPError{
+			Name:       resp.Status,
+			StatusCode: resp.StatusCode,
+			RequestURL: resp.Request.URL.String(),
+			Method:     resp.Request.Method,
+			Body:       body,
+			Problem:    errors.ParseProblem(resp.Header.Get("Content-Type"), body),
+		}
+		return false
+	}
+	it.page++
+
+	if v != nil && len(body) > 0 {
+		if err := json.Unmarshal(body, v); err != nil {
+			it.err = err
+			return false
+		}
+	}
+
+	it.next, err = it.strategy.Next(it.page, resp.Response, body)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	if it.next == nil {
+		it.done = true
+	}
+	return true
+}
+
+// Err returns error that stopped iteration, if any.
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// Response returns response for last fetched page. Body of returned
+// response is already consumed.
+func (it *Iterator) Response() *kioto.Response {
+	return it.resp
+}
+
+// Page returns number of pages fetched so far.
+func (it *Iterator) Page() int {
+	return it.page
+}
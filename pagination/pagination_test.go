@@ -0,0 +1,224 @@
+package pagination_test
+
+import (
+	"context"
+	sterrors "errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/delicb/kioto"
+	"github.com/delicb/kioto/middlewares/errors"
+	"github.com/delicb/kioto/pagination"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var items = []int{1, 2, 3, 4, 5, 6, 7}
+
+func collect(t *testing.T, it *pagination.Iterator) ([][]int, error) {
+	t.Helper()
+	var pages [][]int
+	for {
+		var page []int
+		if !it.Next(&page) {
+			break
+		}
+		pages = append(pages, page)
+	}
+	return pages, it.Err()
+}
+
+func TestLinkHeader(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 0 {
+			page = 1
+		}
+		if page < 3 {
+			w.Header().Add("Link", fmt.Sprintf(`</items?page=%d>; rel="next", </items?page=3>; rel="last"`, page+1))
+		}
+		fmt.Fprintf(w, "[%d]", page)
+	}))
+	defer server.Close()
+
+	client := kioto.New()
+	it := pagination.New(client.Request().Get().URL(server.URL+"/items"), pagination.LinkHeader{})
+	pages, err := collect(t, it)
+	require.NoError(t, err)
+	assert.Equal(t, [][]int{{1}, {2}, {3}}, pages)
+	assert.Equal(t, 3, it.Page())
+	assert.Equal(t, "page=3", it.Response().Request.URL.RawQuery)
+}
+
+func TestCursor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("after") {
+		case "":
+			fmt.Fprint(w, `{"data": [1, 2], "meta": {"next": "abc"}}`)
+		case "abc":
+			fmt.Fprint(w, `{"data": [3], "meta": {"next": 42}}`)
+		case "42":
+			fmt.Fprint(w, `{"data": [4], "meta": {"next": null}}`)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	type page struct {
+		Data []int `json:"data"`
+	}
+	it := pagination.New(kioto.New().Request().Get().URL(server.URL), &pagination.Cursor{Field: "meta.next", Param: "after"})
+	var result []int
+	for {
+		var p page
+		if !it.Next(&p) {
+			break
+		}
+		result = append(result, p.Data...)
+	}
+	require.NoError(t, it.Err())
+	assert.Equal(t, []int{1, 2, 3, 4}, result)
+}
+
+func pagedServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		var start, size int
+		if q.Get("page") != "" {
+			page, _ := strconv.Atoi(q.Get("page"))
+			size, _ = strconv.Atoi(q.Get("per_page"))
+			start = (page - 1) * size
+		} else {
+			start, _ = strconv.Atoi(q.Get("offset"))
+			size, _ = strconv.Atoi(q.Get("limit"))
+		}
+		end := start + size
+		if start > len(items) {
+			start = len(items)
+		}
+		if end > len(items) {
+			end = len(items)
+		}
+		fmt.Fprintf(w, `{"items": %s}`, toJSON(items[start:end]))
+	}))
+}
+
+func toJSON(values []int) string {
+	s := "["
+	for i, v := range values {
+		if i > 0 {
+			s += ","
+		}
+		s += strconv.Itoa(v)
+	}
+	return s + "]"
+}
+
+type itemsPage struct {
+	Items []int `json:"items"`
+}
+
+func TestPageNumber(t *testing.T) {
+	server := pagedServer()
+	defer server.Close()
+
+	it := pagination.New(kioto.New().Request().Get().URL(server.URL), &pagination.PageNumber{PerPage: 3, ItemsField: "items"})
+	var pages [][]int
+	var p itemsPage
+	for it.Next(&p) {
+		pages = append(pages, p.Items)
+		p = itemsPage{}
+	}
+	require.NoError(t, it.Err())
+	assert.Equal(t, [][]int{{1, 2, 3}, {4, 5, 6}, {7}}, pages)
+}
+
+func TestOffset(t *testing.T) {
+	server := pagedServer()
+	defer server.Close()
+
+	it := pagination.New(kioto.New().Request().Get().URL(server.URL), &pagination.Offset{Limit: 7, ItemsField: "items"})
+	var pages [][]int
+	var p itemsPage
+	for it.Next(&p) {
+		pages = append(pages, p.Items)
+		p = itemsPage{}
+	}
+	require.NoError(t, it.Err())
+	// last page is full, so one more (empty) page is requested
+	assert.Equal(t, [][]int{{1, 2, 3, 4, 5, 6, 7}, {}}, pages)
+}
+
+func TestMaxPages(t *testing.T) {
+	server := pagedServer()
+	defer server.Close()
+
+	it := pagination.New(kioto.New().Request().Get().URL(server.URL), &pagination.Offset{Limit: 2, ItemsField: "items"}, pagination.MaxPages(2))
+	var pages [][]int
+	var p itemsPage
+	for it.Next(&p) {
+		pages = append(pages, p.Items)
+		p = itemsPage{}
+	}
+	require.NoError(t, it.Err())
+	assert.Equal(t, [][]int{{1, 2}, {3, 4}}, pages)
+}
+
+func TestContextCancel(t *testing.T) {
+	server := pagedServer()
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := kioto.New().Request().Get().URL(server.URL).WithContext(ctx)
+	it := pagination.New(req, &pagination.PageNumber{PerPage: 1, ItemsField: "items"})
+	var p itemsPage
+	require.True(t, it.Next(&p))
+	cancel()
+	assert.False(t, it.Next(&p))
+	assert.Equal(t, context.Canceled, it.Err())
+}
+
+func TestErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page == 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"items": [100]}`)
+			return
+		}
+		fmt.Fprintf(w, `{"items": [%d]}`, page)
+	}))
+	defer server.Close()
+
+	it := pagination.New(kioto.New().Request().Get().URL(server.URL), &pagination.PageNumber{PerPage: 1, ItemsField: "items"})
+	var pages []itemsPage
+	for {
+		var p itemsPage
+		if !it.Next(&p) {
+			break
+		}
+		pages = append(pages, p)
+	}
+	assert.Equal(t, []itemsPage{{Items: []int{1}}}, pages)
+	assert.Equal(t, 1, it.Page())
+	var httpErr *errors.HTTPError
+	require.True(t, sterrors.As(it.Err(), &httpErr), "wrong error: %v", it.Err())
+	assert.Equal(t, http.StatusInternalServerError, httpErr.StatusCode)
+	assert.Equal(t, `{"items": [100]}`, string(httpErr.Body))
+	assert.False(t, it.Next(nil), "iteration stopped")
+}
+
+func TestItemsNotArray(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"items": "nope"}`)
+	}))
+	defer server.Close()
+
+	it := pagination.New(kioto.New().Request().Get().URL(server.URL), &pagination.PageNumber{ItemsField: "items"})
+	assert.False(t, it.Next(nil))
+	assert.Error(t, it.Err())
+}
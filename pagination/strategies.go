@@ -0,0 +1,275 @@
+package pagination
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/delicb/kioto/cliware"
+	"github.com/delicb/kioto/middlewares/query"
+)
+
+// LinkHeader is Strategy that follows URL from Link header (RFC 8288) with
+// relation type "next". Relative URLs are resolved against URL of the request.
+type LinkHeader struct{}
+
+// First is implementation of Strategy interface.
+func (LinkHeader) First() cliware.Middleware { return nil }
+
+// Next is implementation of Strategy interface.
+func (LinkHeader) Next(page int, resp *http.Response, body []byte) (cliware.Middleware, error) {
+	target := nextLink(resp.Header["Link"])
+	if target == "" {
+		return nil, nil
+	}
+	next, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("pagination: invalid next link %q: %v", target, err)
+	}
+	if resp.Request != nil && resp.Request.URL != nil {
+		next = resp.Request.URL.ResolveReference(next)
+	}
+	return cliware.RequestProcessor(func(req *http.Request) error {
+		u := *next
+		req.URL = &u
+		return nil
+	}), nil
+}
+
+// Cursor is Strategy for APIs that return cursor for next page in JSON body.
+// Cursor is sent back as query parameter.
+type Cursor struct {
+	// Field is dot separated path to cursor in JSON response (e.g. "meta.next_cursor").
+	Field string
+	// Param is name of query parameter used to send cursor. Defaults to "cursor".
+	Param string
+}
+
+// First is implementation of Strategy interface.
+func (s *Cursor) First() cliware.Middleware { return nil }
+
+// Next is implementation of Strategy interface.
+func (s *Cursor) Next(page int, resp *http.Response, body []byte) (cliware.Middleware, error) {
+	data, err := decode(body)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := lookup(data, s.Field)
+	if !ok || value == nil {
+		return nil, nil
+	}
+	var cursor string
+	switch v := value.(type) {
+	case string:
+		cursor = v
+	case json.Number:
+		cursor = v.String()
+	default:
+		return nil, fmt.Errorf("pagination: cursor field %q is not string or number", s.Field)
+	}
+	if cursor == "" {
+		return nil, nil
+	}
+	return query.Set(defaultString(s.Param, "cursor"), cursor), nil
+}
+
+// PageNumber is Strategy for APIs that select page by its number. Iteration
+// stops when page contains fewer than PerPage items (or no items at all if
+// PerPage is not set).
+type PageNumber struct {
+	// PageParam is name of query parameter for page number. Defaults to "page".
+	PageParam string
+	// PerPageParam is name of query parameter for page size. Defaults to "per_page".
+	PerPageParam string
+	// PerPage is requested page size. If zero, page size is not sent.
+	PerPage int
+	// StartPage is number of first page. Defaults to 1.
+	StartPage int
+	// ItemsField is dot separated path to array of items in JSON response.
+	// Empty value means that response itself is an array.
+	ItemsField string
+}
+
+// First is implementation of Strategy interface.
+func (s *PageNumber) First() cliware.Middleware {
+	return s.request(s.startPage())
+}
+
+// Next is implementation of Strategy interface.
+func (s *PageNumber) Next(page int, resp *http.Response, body []byte) (cliware.Middleware, error) {
+	count, err := countItems(body, s.ItemsField)
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 || (s.PerPage > 0 && count < s.PerPage) {
+		return nil, nil
+	}
+	return s.request(s.startPage() + page), nil
+}
+
+func (s *PageNumber) startPage() int {
+	if s.StartPage == 0 {
+		return 1
+	}
+	return s.StartPage
+}
+
+func (s *PageNumber) request(page int) cliware.Middleware {
+	params := map[string]string{
+		defaultString(s.PageParam, "page"): strconv.Itoa(page),
+	}
+	if s.PerPage > 0 {
+		params[defaultString(s.PerPageParam, "per_page")] = strconv.Itoa(s.PerPage)
+	}
+	return query.SetMap(params)
+}
+
+// Offset is Strategy for APIs that select page by offset and limit. Offset
+// is advanced by number of items in each page and iteration stops when page
+// contains fewer than Limit items (or no items at all if Limit is not set).
+// Offset keeps current position, so one instance should be used by one
+// Iterator at a time.
+type Offset struct {
+	// OffsetParam is name of query parameter for offset. Defaults to "offset".
+	OffsetParam string
+	// LimitParam is name of query parameter for limit. Defaults to "limit".
+	LimitParam string
+	// Limit is requested page size. If zero, limit is not sent.
+	Limit int
+	// ItemsField is dot separated path to array of items in JSON response.
+	// Empty value means that response itself is an array.
+	ItemsField string
+
+	offset int
+}
+
+// First is implementation of Strategy interface.
+func (s *Offset) First() cliware.Middleware {
+	s.offset = 0
+	return s.request()
+}
+
+// Next is implementation of Strategy interface.
+func (s *Offset) Next(page int, resp *http.Response, body []byte) (cliware.Middleware, error) {
+	count, err := countItems(body, s.ItemsField)
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 || (s.Limit > 0 && count < s.Limit) {
+		return nil, nil
+	}
+	s.offset += count
+	return s.request(), nil
+}
+
+func (s *Offset) request() cliware.Middleware {
+	params := map[string]string{
+		defaultString(s.OffsetParam, "offset"): strconv.Itoa(s.offset),
+	}
+	if s.Limit > 0 {
+		params[defaultString(s.LimitParam, "limit")] = strconv.Itoa(s.Limit)
+	}
+	return query.SetMap(params)
+}
+
+// nextLink returns target of link with relation type "next" from provided
+// Link header values, or empty string if there is no such link.
+func nextLink(values []string) string {
+	for _, value := range values {
+		for _, link := range splitLinks(value) {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range parts[1:] {
+				kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+				if len(kv) != 2 || !strings.EqualFold(strings.TrimSpace(kv[0]), "rel") {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(kv[1]), `"`)) {
+					if strings.EqualFold(rel, "next") {
+						return target[1 : len(target)-1]
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// splitLinks splits Link header value on commas that are not part of URL.
+func splitLinks(value string) []string {
+	var links []string
+	inURL, inQuote := false, false
+	start := 0
+	for i, r := range value {
+		switch {
+		case r == '<' && !inQuote:
+			inURL = true
+		case r == '>' && !inQuote:
+			inURL = false
+		case r == '"' && !inURL:
+			inQuote = !inQuote
+		case r == ',' && !inURL && !inQuote:
+			links = append(links, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(links, value[start:])
+}
+
+func decode(body []byte) (interface{}, error) {
+	var data interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&data); err != nil {
+		return nil, fmt.Errorf("pagination: failed to decode response: %v", err)
+	}
+	return data, nil
+}
+
+// lookup returns value on dot separated path in decoded JSON.
+func lookup(data interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return data, true
+	}
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := data.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		data, ok = obj[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return data, true
+}
+
+func countItems(body []byte, field string) (int, error) {
+	data, err := decode(body)
+	if err != nil {
+		return 0, err
+	}
+	value, ok := lookup(data, field)
+	if !ok || value == nil {
+		return 0, nil
+	}
+	items, ok := value.([]interface{})
+	if !ok {
+		return 0, fmt.Errorf("pagination: items field %q is not an array", field)
+	}
+	return len(items), nil
+}
+
+func defaultString(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
@@ -40,6 +40,21 @@ func (r *Request) WithContext(ctx context.Context) *Request {
 	return r
 }
 
+// Clone returns copy of this request that uses same client and context.
+// Middlewares added to the copy do not affect original request and vice versa,
+// which makes it possible to send same request multiple times with different
+// modifications (e.g. for different pages of paginated endpoint).
+func (r *Request) Clone() *Request {
+	own := r.middlewares.Middlewares()
+	middlewares := make([]cliware.Middleware, len(own))
+	copy(middlewares, own)
+	return &Request{
+		Client:      r.Client,
+		middlewares: r.Client.preMiddlewares.ChildChain(middlewares...),
+		context:     r.context,
+	}
+}
+
 // Use adds middlewares that will be applied to this request only.
 func (r *Request) Use(m ...cliware.Middleware) *Request {
 	r.middlewares.Use(m...)
@@ -61,7 +76,9 @@ func (r *Request) Send() (*Response, error) {
 	}
 	req := cliware.EmptyRequest().WithContext(r.context)
 	resp, err := sender.Handle(req)
-	return buildResponse(resp, err), err
+	response := buildResponse(resp, err)
+	response.codecs = r.Client.codecs
+	return response, err
 }
 
 // Utility methods - shortcuts to using middlewares. These should not map all
@@ -112,6 +129,13 @@ func (r *Request) Header(key, val string) *Request {
 	return r
 }
 
+// Encode sets HTTP body for this request to provided data, encoded by codec
+// registered in client for provided content type.
+func (r *Request) Encode(contentType string, data interface{}) *Request {
+	r.Use(body.Encode(r.Client.codecs, contentType, data))
+	return r
+}
+
 // Body sets HTTP body for this request.
 func (r *Request) Body(reader io.Reader) *Request {
 	r.Use(body.Reader(reader))
@@ -68,6 +68,27 @@ func (t *requestSuite) TestUseFunc() {
 	t.True(called, "function middleware not called")
 }
 
+func (t *requestSuite) TestClone() {
+	type ctxKey string
+	ctx := context.WithValue(context.Background(), ctxKey("a"), "b")
+	req := NewRequest(t.client).WithContext(ctx).Method("FOO")
+	clone := req.Clone()
+	clone.URL("http://example.com/clone")
+	req.URL("http://example.com/original")
+
+	t.Equal(req.Client, clone.Client)
+	t.Equal(ctx, clone.Context())
+
+	_, err := clone.Send()
+	t.NoError(err)
+	t.Equal("FOO", t.trackingClient.lastRequest.Method)
+	t.Equal("http://example.com/clone", t.trackingClient.lastRequest.URL.String())
+
+	_, err = req.Send()
+	t.NoError(err)
+	t.Equal("http://example.com/original", t.trackingClient.lastRequest.URL.String())
+}
+
 func (t *requestSuite) TestMethod() {
 	req := NewRequest(t.client)
 	req.Method("FOO")
@@ -1,9 +1,16 @@
 package kioto
 
 import (
+	"bytes"
 	"encoding/json"
 	"io"
+	"io/ioutil"
 	"net/http"
+
+	"github.com/delicb/kioto/codec"
+	"github.com/delicb/kioto/middlewares/requestid"
+	"github.com/delicb/kioto/middlewares/responsebody"
+	"github.com/delicb/kioto/middlewares/timing"
 )
 
 // Response is thin wrapper around http.Response that provides some
@@ -11,14 +18,27 @@ import (
 type Response struct {
 	*http.Response
 	Error error
+	// Timings holds durations of request phases, per attempt. It is set
+	// only if timing.Trace middleware is used.
+	Timings *timing.Timings
+	// RequestID is request ID server echoed in response. It is set only if
+	// requestid middleware is used and server returned the ID.
+	RequestID string
+
+	codecs *codec.Registry
 }
 
 // buildResponse creates new instance of response based on raw HTTP response.
 func buildResponse(rawResponse *http.Response, err error) *Response {
-	return &Response{
+	resp := &Response{
 		Response: rawResponse,
 		Error:    err,
 	}
+	if rawResponse != nil && rawResponse.Request != nil {
+		resp.Timings = timing.FromContext(rawResponse.Request.Context())
+		resp.RequestID = requestid.FromResponse(rawResponse)
+	}
+	return resp
 }
 
 // JSON decodes response body to provided structure from JSON format. Parameter
@@ -44,3 +64,85 @@ func (r *Response) JSON(userStruct interface{}) (err error) {
 	}
 	return nil
 }
+
+// Decode decodes response body to provided value using codec selected by
+// response Content-Type header. Codecs registered in client are used, or
+// codec.Default if response is not created by client. If there is no codec for
+// response content type, *codec.UnsupportedContentTypeError is returned.
+func (r *Response) Decode(v interface{}) (err error) {
+	if r.Error != nil {
+		return r.Error
+	}
+
+	defer func() {
+		closeErr := r.Body.Close()
+		if err == nil && closeErr != nil {
+			err = closeErr
+		}
+	}()
+
+	registry := r.codecs
+	if registry == nil {
+		registry = codec.Default
+	}
+	dec, err := registry.Lookup(r.Header.Get("Content-Type"))
+	if err != nil {
+		return err
+	}
+	return dec.Decode(r.Body, v)
+}
+
+// Bytes returns whole response body. Body is buffered, so it can still be
+// read (or decoded) after Bytes is called and Bytes can be called multiple
+// times. If responsebody.Replayable middleware is used, its buffer is reused.
+func (r *Response) Bytes() ([]byte, error) {
+	if r.Error != nil {
+		return nil, r.Error
+	}
+	body, err := r.replayableBody()
+	if err != nil {
+		return nil, err
+	}
+	return body.Bytes()
+}
+
+// String returns whole response body as string. Same as with Bytes, body
+// can be read again afterwards.
+func (r *Response) String() (string, error) {
+	data, err := r.Bytes()
+	return string(data), err
+}
+
+// Release frees resources held by response body. If body is buffered (by
+// responsebody.Replayable middleware or by Bytes and String), buffer is
+// released and temporary file holding it is closed, otherwise body is
+// closed. Body can not be read after it is released.
+func (r *Response) Release() error {
+	if r.Response == nil || r.Body == nil {
+		return nil
+	}
+	if body, ok := r.Body.(*responsebody.ReplayableBody); ok {
+		return body.Release()
+	}
+	return r.Body.Close()
+}
+
+// replayableBody makes sure response body can be read multiple times.
+func (r *Response) replayableBody() (*responsebody.ReplayableBody, error) {
+	if body, ok := r.Body.(*responsebody.ReplayableBody); ok {
+		return body, nil
+	}
+	// whole body ends up in memory anyway, so there is no need for
+	// temporary file that would have to be removed later
+	data, err := ioutil.ReadAll(r.Body)
+	closeErr := r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	body, err := responsebody.NewReplayableBody(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	r.Body = body
+	return body, closeErr
+}
@@ -2,11 +2,16 @@ package kioto
 
 import (
 	"errors"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"os"
 	"strings"
 	"testing"
 
+	"github.com/delicb/kioto/cliware"
+	"github.com/delicb/kioto/codec"
+	"github.com/delicb/kioto/middlewares/responsebody"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -47,6 +52,133 @@ func (t *responseSuite) TestJSONBadSyntax() {
 	t.Error(err)
 }
 
+func (t *responseSuite) TestDecode() {
+	type d struct {
+		A string `json:"a" xml:"a"`
+	}
+	for _, data := range []struct {
+		contentType string
+		body        string
+	}{
+		{"application/json", `{"a": "foo"}`},
+		{"application/vnd.api+json; charset=utf-8", `{"a": "foo"}`},
+		{"application/xml", `<d><a>foo</a></d>`},
+	} {
+		rawResponse := &http.Response{
+			Header: http.Header{"Content-Type": {data.contentType}},
+			Body:   ioutil.NopCloser(strings.NewReader(data.body)),
+		}
+		resp := buildResponse(rawResponse, nil)
+		result := new(d)
+		t.NoError(resp.Decode(result), data.contentType)
+		t.Equal("foo", result.A, data.contentType)
+	}
+}
+
+func (t *responseSuite) TestDecodeText() {
+	rawResponse := &http.Response{
+		Header: http.Header{"Content-Type": {"text/html"}},
+		Body:   ioutil.NopCloser(strings.NewReader("<p>foo</p>")),
+	}
+	var result string
+	t.NoError(buildResponse(rawResponse, nil).Decode(&result))
+	t.Equal("<p>foo</p>", result)
+}
+
+func (t *responseSuite) TestDecodeUnsupported() {
+	rawResponse := &http.Response{
+		Header: http.Header{"Content-Type": {"application/octet-stream"}},
+		Body:   ioutil.NopCloser(strings.NewReader("foo")),
+	}
+	var result string
+	err := buildResponse(rawResponse, nil).Decode(&result)
+	var unsupported *codec.UnsupportedContentTypeError
+	t.True(errors.As(err, &unsupported), "wrong error: %v", err)
+	t.Equal("application/octet-stream", unsupported.ContentType)
+}
+
+func (t *responseSuite) TestDecodeHTTPError() {
+	err := errors.New("some error")
+	var result string
+	t.Equal(err, buildResponse(nil, err).Decode(&result))
+}
+
+func (t *responseSuite) TestBytes() {
+	rawResponse := &http.Response{
+		Body: ioutil.NopCloser(strings.NewReader(`{"a": "foo"}`)),
+	}
+	resp := buildResponse(rawResponse, nil)
+	data, err := resp.Bytes()
+	t.NoError(err)
+	t.Equal(`{"a": "foo"}`, string(data))
+
+	s, err := resp.String()
+	t.NoError(err)
+	t.Equal(`{"a": "foo"}`, s)
+
+	decoded := make(map[string]string)
+	t.NoError(resp.JSON(&decoded))
+	t.Equal("foo", decoded["a"])
+}
+
+func (t *responseSuite) TestBytesReplayable() {
+	body, err := responsebody.NewReplayableBody(strings.NewReader("foo"), 0)
+	t.Require().NoError(err)
+	resp := buildResponse(&http.Response{Body: body}, nil)
+	_, err = resp.Bytes()
+	t.NoError(err)
+	t.Equal(body, resp.Body, "replayable body replaced")
+}
+
+func (t *responseSuite) TestRelease() {
+	dir, err := ioutil.TempDir("", "kioto-response")
+	t.Require().NoError(err)
+	defer os.RemoveAll(dir)
+	t.T().Setenv("TMPDIR", dir)
+
+	rawResponse := &http.Response{
+		Header: http.Header{"Content-Type": {"application/json"}},
+		Body:   ioutil.NopCloser(strings.NewReader(`{"a": "` + strings.Repeat("x", 100) + `"}`)),
+	}
+	rawResponse, err = responsebody.Replayable(10).Exec(cliware.HandlerFunc(
+		func(*http.Request) (*http.Response, error) { return rawResponse, nil },
+	)).Handle(cliware.EmptyRequest())
+	t.Require().NoError(err)
+	resp := buildResponse(rawResponse, nil)
+
+	decoded := make(map[string]string)
+	t.NoError(resp.Decode(&decoded))
+	t.Len(decoded["a"], 100)
+	files, err := ioutil.ReadDir(dir)
+	t.Require().NoError(err)
+	t.Empty(files, "temporary file left on disk")
+
+	t.NoError(resp.Release())
+	_, err = resp.Bytes()
+	t.Error(err, "body readable after release")
+
+	closed := &closeTracker{Reader: strings.NewReader("foo")}
+	t.NoError(buildResponse(&http.Response{Body: closed}, nil).Release())
+	t.True(closed.closed)
+	t.NoError(buildResponse(nil, errors.New("some error")).Release())
+}
+
+type closeTracker struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeTracker) Close() error {
+	c.closed = true
+	return nil
+}
+
+func (t *responseSuite) TestBytesHTTPError() {
+	err := errors.New("some error")
+	_, gotErr := buildResponse(nil, err).String()
+	t.Equal(err, gotErr)
+}
+
 func TestResponseSuite(t *testing.T) {
 	suite.Run(t, new(responseSuite))
 }